@@ -0,0 +1,65 @@
+// Command apisnapshot writes the API snapshot files of Go packages, which
+// record the json encoding of their exported struct types. The jsontag
+// analyzer run with -snapshot reports changes to the encoding that break API
+// compatibility, until the snapshot files are written again.
+//
+// Usage:
+//
+//	apisnapshot [-snapshot api.json] packages...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/NebulousLabs/analyze/jsontag"
+	"golang.org/x/tools/go/packages"
+)
+
+func main() {
+	name := flag.String("snapshot", "api.json", "name of the API snapshot file in the package directory")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: apisnapshot [-snapshot api.json] packages...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Args(), *name); err != nil {
+		fmt.Fprintln(os.Stderr, "apisnapshot:", err)
+		os.Exit(1)
+	}
+}
+
+// run writes the snapshot file with the given name into the directory of each
+// package matched by patterns.
+func run(patterns []string, name string) error {
+	cfg := &packages.Config{Mode: packages.NeedName | packages.NeedFiles | packages.NeedTypes}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return err
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return fmt.Errorf("could not load packages")
+	}
+
+	for _, p := range pkgs {
+		if len(p.GoFiles) == 0 {
+			continue
+		}
+		b, err := jsontag.Snapshot(p.Fset, p.Types)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(filepath.Dir(p.GoFiles[0]), name)
+		if err := ioutil.WriteFile(path, b, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Command jsonschema prints the JSON Schema, or the OpenAPI 3 component
+// schemas, of the exported struct types of Go packages. The schemas follow the
+// rules of encoding/json, and the json struct tags checked by the jsontag
+// analyzer.
+//
+// Usage:
+//
+//	jsonschema [-openapi] [-types T1,T2] packages...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/types"
+	"os"
+	"strings"
+
+	"gitlab.com/NebulousLabs/analyze/jsontag"
+	"golang.org/x/tools/go/packages"
+)
+
+func main() {
+	openAPI := flag.Bool("openapi", false, "print OpenAPI 3 component schemas instead of a JSON Schema")
+	typeNames := flag.String("types", "", "comma-separated names of the types to print, instead of all exported struct types")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jsonschema [-openapi] [-types T1,T2] packages...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Args(), *typeNames, *openAPI); err != nil {
+		fmt.Fprintln(os.Stderr, "jsonschema:", err)
+		os.Exit(1)
+	}
+}
+
+// run prints the schemas of the exported struct types of the packages matched
+// by patterns.
+func run(patterns []string, typeNames string, openAPI bool) error {
+	cfg := &packages.Config{Mode: packages.NeedName | packages.NeedTypes}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return err
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return fmt.Errorf("could not load packages")
+	}
+
+	var names []string
+	if typeNames != "" {
+		names = strings.Split(typeNames, ",")
+	}
+	refPrefix := "#/$defs/"
+	if openAPI {
+		refPrefix = "#/components/schemas/"
+	}
+	// qualify the names of the types if there is more than one package
+	var pkg *types.Package
+	if len(pkgs) == 1 {
+		pkg = pkgs[0].Types
+	}
+	g := jsontag.NewGenerator(pkg, refPrefix)
+	g.OpenAPI = openAPI
+	found := make(map[string]bool)
+	for _, p := range pkgs {
+		missing := make(map[string]bool)
+		for _, name := range g.AddPackage(p.Types, names...) {
+			missing[name] = true
+		}
+		for _, name := range names {
+			found[name] = found[name] || !missing[name]
+		}
+	}
+	for _, name := range names {
+		if !found[name] {
+			return fmt.Errorf("%s is not an exported struct type of the packages", name)
+		}
+	}
+	defs := g.Defs
+
+	var doc interface{}
+	if openAPI {
+		doc = map[string]interface{}{
+			"components": map[string]interface{}{"schemas": defs},
+		}
+	} else {
+		doc = map[string]interface{}{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"$defs":   defs,
+		}
+	}
+	b, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", b)
+	return err
+}
@@ -1,5 +1,10 @@
 module gitlab.com/NebulousLabs/analyze
 
-go 1.13
+go 1.22.0
 
-require golang.org/x/tools v0.0.0-20200515220128-d3bf790afa53
+require golang.org/x/tools v0.26.0
+
+require (
+	golang.org/x/mod v0.21.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+)
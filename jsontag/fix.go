@@ -0,0 +1,108 @@
+package jsontag
+
+import (
+	"fmt"
+	"go/ast"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// renameFix returns a suggested fix that renames the given key of the struct
+// tag of field to name. Other keys, and the options of the renamed key (e.g.
+// omitempty), are preserved.
+func renameFix(field *ast.Field, key, name string) []analysis.SuggestedFix {
+	return tagFix(field, fmt.Sprintf("Rename %s struct tag to %q", key, name), func(raw string) (string, bool) {
+		return setTagName(raw, key, name)
+	})
+}
+
+// optionFix returns a suggested fix that replaces the option old of the given
+// key of the struct tag of field with new.
+func optionFix(field *ast.Field, key, old, new string) []analysis.SuggestedFix {
+	return tagFix(field, fmt.Sprintf("Replace %s struct tag option %q with %q", key, old, new), func(raw string) (string, bool) {
+		return setTagOption(raw, key, old, new)
+	})
+}
+
+// tagFix returns a suggested fix with the given message that rewrites the
+// struct tag of field using rewrite.
+func tagFix(field *ast.Field, message string, rewrite func(raw string) (string, bool)) []analysis.SuggestedFix {
+	if field.Tag == nil {
+		return nil
+	}
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return nil
+	}
+	rewritten, ok := rewrite(raw)
+	if !ok {
+		return nil
+	}
+	return []analysis.SuggestedFix{{
+		Message: message,
+		TextEdits: []analysis.TextEdit{{
+			Pos:     field.Tag.Pos(),
+			End:     field.Tag.End(),
+			NewText: []byte(quoteTag(field.Tag.Value, rewritten)),
+		}},
+	}}
+}
+
+// setTagName returns the struct tag raw, with the name of the given key set to
+// name. Options following the name are kept as they are. It returns false if
+// raw is malformed or does not contain key.
+func setTagName(raw, key, name string) (string, bool) {
+	return setTagValue(raw, key, func(value string) string {
+		if j := strings.IndexByte(value, ','); j != -1 {
+			return name + value[j:]
+		}
+		return name
+	})
+}
+
+// setTagOption returns the struct tag raw, with the option old of the given
+// key replaced by new. It returns false if raw is malformed or does not
+// contain the option.
+func setTagOption(raw, key, old, new string) (string, bool) {
+	found := false
+	s, ok := setTagValue(raw, key, func(value string) string {
+		opts := strings.Split(value, ",")
+		for i := 1; i < len(opts); i++ {
+			if opts[i] == old && !found {
+				opts[i] = new
+				found = true
+			}
+		}
+		return strings.Join(opts, ",")
+	})
+	if !ok || !found {
+		return "", false
+	}
+	return s, true
+}
+
+// setTagValue returns the struct tag raw, with the value of the given key
+// replaced by the result of set.
+func setTagValue(raw, key string, set func(value string) string) (string, bool) {
+	pairs, err := parseTag(raw)
+	if err != nil {
+		return "", false
+	}
+	for _, p := range pairs {
+		if p.key == key {
+			return raw[:p.pos] + strconv.Quote(set(p.value)) + raw[p.end:], true
+		}
+	}
+	return "", false
+}
+
+// quoteTag returns the struct tag literal for the struct tag raw, replacing the
+// struct tag literal lit. The quoting style of lit is kept where possible.
+func quoteTag(lit, raw string) string {
+	if strings.HasPrefix(lit, "`") && !strings.Contains(raw, "`") {
+		return "`" + raw + "`"
+	}
+	return strconv.Quote(raw)
+}
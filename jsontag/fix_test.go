@@ -0,0 +1,63 @@
+package jsontag
+
+import (
+	"testing"
+)
+
+// TestSetTagName probes the setTagName function
+func TestSetTagName(t *testing.T) {
+	var tests = []struct {
+		raw    string
+		key    string
+		name   string
+		result string
+		ok     bool
+	}{
+		// Valid cases
+		{`json:"a"`, "json", "b", `json:"b"`, true},
+		{`json:"a,omitempty"`, "json", "b", `json:"b,omitempty"`, true},
+		{`json:",omitempty"`, "json", "b", `json:"b,omitempty"`, true},
+		{`yaml:"a" json:"a,string"`, "json", "b", `yaml:"a" json:"b,string"`, true},
+		{`json:"a"  yaml:"a"`, "yaml", "b", `json:"a"  yaml:"b"`, true},
+		{`xml:"a\"b" json:"a"`, "json", "b", `xml:"a\"b" json:"b"`, true},
+
+		// Invalid cases
+		{`yaml:"a"`, "json", "b", "", false},
+		{`json:a`, "json", "b", "", false},
+		{`json:"a`, "json", "b", "", false},
+	}
+
+	for _, test := range tests {
+		result, ok := setTagName(test.raw, test.key, test.name)
+		if result != test.result || ok != test.ok {
+			t.Errorf("setTagName(%q, %q, %q) = %q, %v; expected %q, %v", test.raw, test.key, test.name, result, ok, test.result, test.ok)
+		}
+	}
+}
+
+// TestSetTagOption probes the setTagOption function
+func TestSetTagOption(t *testing.T) {
+	var tests = []struct {
+		raw    string
+		old    string
+		new    string
+		result string
+		ok     bool
+	}{
+		// Valid cases
+		{`json:"a,omitemtpy"`, "omitemtpy", "omitempty", `json:"a,omitempty"`, true},
+		{`json:",strign,omitempty" yaml:"a"`, "strign", "string", `json:",string,omitempty" yaml:"a"`, true},
+
+		// Invalid cases
+		{`json:"omitemtpy"`, "omitemtpy", "omitempty", "", false},
+		{`json:"a,omitempty"`, "omitemtpy", "omitempty", "", false},
+		{`yaml:"a,omitemtpy"`, "omitemtpy", "omitempty", "", false},
+	}
+
+	for _, test := range tests {
+		result, ok := setTagOption(test.raw, "json", test.old, test.new)
+		if result != test.result || ok != test.ok {
+			t.Errorf("setTagOption(%q, %q, %q) = %q, %v; expected %q, %v", test.raw, test.old, test.new, result, ok, test.result, test.ok)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package jsontag
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// ignoreDirective suppresses a check for the field it is attached to, e.g.
+// //jsontag:ignore name the key is part of a legacy API
+const ignoreDirective = "//jsontag:ignore"
+
+// The checks of the analyzer, which are suppressed by name.
+const (
+	// checkName checks that tag names follow the naming convention.
+	checkName = "name"
+	// checkOption checks the options of tags.
+	checkOption = "option"
+	// checkSyntax checks the syntax of struct tags.
+	checkSyntax = "syntax"
+	// checkType checks that tagged fields can be marshalled and are exported.
+	checkType = "type"
+	// checkDuplicate checks that json keys are unique.
+	checkDuplicate = "duplicate"
+	// checkConsistency checks that the names of other struct tags agree
+	// with the json struct tag.
+	checkConsistency = "consistency"
+	// checkUntagged checks that the fields of responses have json struct
+	// tags.
+	checkUntagged = "untagged"
+	// checkMirror checks that the keys of struct types agree with the
+	// struct types of other packages they mirror.
+	checkMirror = "mirror"
+	// checkMarshaler checks that struct types implementing a custom
+	// marshaler implement the matching unmarshaler, and vice versa.
+	checkMarshaler = "marshaler"
+)
+
+// checks are the names of all checks of the analyzer.
+var checks = []string{checkName, checkOption, checkSyntax, checkType, checkDuplicate, checkConsistency, checkUntagged, checkMirror, checkMarshaler}
+
+// ignore is a parsed ignoreDirective.
+type ignore struct {
+	pos    token.Pos
+	check  string
+	key    string // the json key, for directives of a type
+	reason string
+	used   bool
+}
+
+// reporter reports the diagnostics of the fields of a struct, suppressing the
+// ones ignored by a directive.
+type reporter struct {
+	pass    *analysis.Pass
+	ignores map[token.Pos][]*ignore
+	keys    map[string][]*ignore
+	all     []*ignore
+
+	// enabled are the checks that run for the struct, directives for other
+	// checks are not stale.
+	enabled map[string]bool
+}
+
+// newReporter returns a reporter for the fields of st, which are checked by the
+// enabled checks. Malformed directives attached to its fields are reported
+// right away.
+func newReporter(pass *analysis.Pass, st *ast.StructType, enabled map[string]bool) *reporter {
+	r := &reporter{
+		pass:    pass,
+		ignores: make(map[token.Pos][]*ignore),
+		keys:    make(map[string][]*ignore),
+		enabled: make(map[string]bool),
+	}
+	for check, ok := range enabled {
+		r.enabled[check] = ok
+	}
+	for _, f := range st.Fields.List {
+		var ignores []*ignore
+		for _, cg := range []*ast.CommentGroup{f.Doc, f.Comment} {
+			if cg == nil {
+				continue
+			}
+			for _, c := range cg.List {
+				if ig, ok := r.parseIgnore(c); ok {
+					ignores = append(ignores, ig)
+				}
+			}
+		}
+		r.all = append(r.all, ignores...)
+
+		// diagnostics are reported at the position of the field names, or
+		// the type of an embedded field
+		if len(f.Names) == 0 {
+			r.ignores[embeddedPos(f.Type)] = ignores
+		}
+		for _, name := range f.Names {
+			r.ignores[name.Pos()] = ignores
+		}
+	}
+	return r
+}
+
+// parseTypeIgnores parses the directives in the comments of the struct type
+// declared at pos, which suppress the marshaler check for the type, e.g.
+// //jsontag:ignore marshaler the reason, or the mirror check for a json key
+// that is missing from the struct, e.g. //jsontag:ignore mirror key the reason.
+// Malformed directives are reported right away.
+func (r *reporter) parseTypeIgnores(docs []*ast.CommentGroup, pos token.Pos) {
+	for _, cg := range docs {
+		for _, c := range cg.List {
+			ig, ok := r.parseIgnore(c)
+			if !ok {
+				continue
+			}
+			if ig.check == checkMarshaler {
+				r.ignores[pos] = append(r.ignores[pos], ig)
+				r.all = append(r.all, ig)
+				continue
+			}
+			if ig.check != checkMirror {
+				r.pass.Reportf(c.Pos(), "jsontag:ignore directive of a type only supports checks %q and %q, attach it to a field instead", checkMarshaler, checkMirror)
+				continue
+			}
+			args := strings.Fields(ig.reason)
+			if len(args) < 2 {
+				r.pass.Reportf(c.Pos(), "jsontag:ignore directive for check %q of a type requires a json key and a reason", ig.check)
+				continue
+			}
+			ig.key, ig.reason = args[0], strings.Join(args[1:], " ")
+			r.keys[ig.key] = append(r.keys[ig.key], ig)
+			r.all = append(r.all, ig)
+		}
+	}
+}
+
+// parseIgnore parses c as an ignoreDirective, reporting it if it is malformed.
+func (r *reporter) parseIgnore(c *ast.Comment) (*ignore, bool) {
+	if c.Text != ignoreDirective && !strings.HasPrefix(c.Text, ignoreDirective+" ") {
+		return nil, false
+	}
+	args := strings.Fields(strings.TrimPrefix(c.Text, ignoreDirective))
+	if len(args) == 0 {
+		r.pass.Reportf(c.Pos(), "jsontag:ignore directive requires a check and a reason")
+		return nil, false
+	}
+	if !isCheck(args[0]) {
+		r.pass.Reportf(c.Pos(), "jsontag:ignore directive names unknown check %q, expected one of %s", args[0], strings.Join(checks, ", "))
+		return nil, false
+	}
+	if len(args) == 1 {
+		r.pass.Reportf(c.Pos(), "jsontag:ignore directive for check %q requires a reason", args[0])
+		return nil, false
+	}
+	return &ignore{
+		pos:    c.Pos(),
+		check:  args[0],
+		reason: strings.Join(args[1:], " "),
+	}, true
+}
+
+// report reports d, unless check is ignored for the field at d.Pos.
+func (r *reporter) report(check string, d analysis.Diagnostic) {
+	if r.suppress(check, d.Pos) == nil {
+		r.pass.Report(d)
+	}
+}
+
+// suppress returns the directive ignoring check for the field at pos, marking
+// it as used, or nil if there is none.
+func (r *reporter) suppress(check string, pos token.Pos) *ignore {
+	for _, ig := range r.ignores[pos] {
+		if ig.check == check {
+			ig.used = true
+			return ig
+		}
+	}
+	return nil
+}
+
+// reportf is like report, but formats the message of the diagnostic.
+func (r *reporter) reportf(check string, pos token.Pos, format string, args ...interface{}) {
+	r.report(check, analysis.Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// reportKeyf reports a diagnostic about the json key of the struct, unless
+// check is ignored for the key by a directive of the type.
+func (r *reporter) reportKeyf(check, key string, pos token.Pos, format string, args ...interface{}) {
+	for _, ig := range r.keys[key] {
+		if ig.check == check {
+			ig.used = true
+			return
+		}
+	}
+	r.pass.Reportf(pos, format, args...)
+}
+
+// enable enables check for the struct, in addition to the checks the reporter
+// was created with.
+func (r *reporter) enable(check string) {
+	r.enabled[check] = true
+}
+
+// reportStale reports the directives that did not suppress any diagnostic.
+// Directives for checks that are not enabled, e.g. untagged without
+// -requiretags, are not reported.
+func (r *reporter) reportStale() {
+	for _, ig := range r.all {
+		if !ig.used && r.enabled[ig.check] {
+			r.pass.Reportf(ig.pos, "jsontag:ignore directive for check %q does not suppress any diagnostic", ig.check)
+		}
+	}
+}
+
+// enabledChecks returns the checks that run for every struct with the given
+// struct tag keys and the current flags. The mirror check is only enabled for
+// the structs that mirror another struct.
+func enabledChecks(keys []string) map[string]bool {
+	enabled := map[string]bool{
+		checkName:      true,
+		checkOption:    true,
+		checkSyntax:    true,
+		checkType:      true,
+		checkDuplicate: true,
+		checkUntagged:  flagRequireTags,
+		checkMarshaler: true,
+	}
+	for _, key := range keys {
+		if key != "json" {
+			enabled[checkConsistency] = true
+		}
+	}
+	return enabled
+}
+
+// isCheck returns whether name is one of the checks.
+func isCheck(name string) bool {
+	for _, c := range checks {
+		if name == c {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedPos returns the position of the name of an embedded field of type
+// typ, which is where go/types declares the field. Instantiated generic types
+// are declared at the name of the generic type.
+func embeddedPos(typ ast.Expr) token.Pos {
+	switch t := typ.(type) {
+	case *ast.StarExpr:
+		return embeddedPos(t.X)
+	case *ast.IndexExpr:
+		return embeddedPos(t.X)
+	case *ast.IndexListExpr:
+		return embeddedPos(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Pos()
+	}
+	return typ.Pos()
+}
@@ -3,11 +3,13 @@
 package jsontag
 
 import (
+	"fmt"
 	"go/ast"
 	"go/types"
 	"reflect"
 	"strings"
 
+	"gitlab.com/NebulousLabs/analyze/lockcheck"
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/passes/inspect"
 	"golang.org/x/tools/go/ast/inspector"
@@ -16,7 +18,85 @@ import (
 // Doc is the CLI help text for the jsontag analyzer.
 const Doc = `check that json struct field tags conform to conventions.
 
-json fields are always lowercase, and should match the Go field name.`
+json fields should match the Go field name following a naming convention,
+which is selected with the -naming flag, or per package with a
+//jsontag:naming directive. The conventions are:
+  - lowercase: the lowercased field name, e.g. UserID -> userid (default)
+  - camel: camelCase, e.g. UserID -> userId
+  - snake: snake_case, e.g. UserID -> user_id
+  - kebab: kebab-case, e.g. UserID -> user-id
+Words that are ignored at the start of field and tag names, e.g. StaticFoo ->
+foo, are set with the comma-separated -ignoreprefixes flag, and default to the
+prefixes of the lockcheck conventions, i.e. static, atomic, extern, managed,
+threaded and call, along with deprecated. Words that are ignored at their end,
+e.g. FooDeprecated -> foo, are set with the -ignoresuffixes flag, and default
+to deprecated.
+
+All struct types are checked where they are declared, including anonymous
+struct types, struct types in type parameter constraints and generic struct
+types, whose fields are checked once however often they are instantiated.
+
+Other struct tag keys, e.g. yaml or toml, are checked by adding them to the
+comma-separated -keys flag, which defaults to json. Their names should agree
+with the json struct tag of the field, or follow the naming convention if
+there is none. Tags without a name, e.g. yaml:",omitempty", and inlined fields,
+e.g. yaml:",inline", are not checked.
+
+Struct types implementing both a custom marshaler and a custom unmarshaler,
+i.e. json.Marshaler and json.Unmarshaler or their encoding.Text equivalents,
+are skipped, as encoding/json does not use their struct tags. Types that
+implement only one of a pair are reported, unless the doc comment of the type
+ignores the marshaler check, e.g.
+  //jsontag:ignore marshaler only ever encoded
+
+Fields that encoding/json drops because their json key is also used by
+another field, including fields promoted from embedded structs, are reported.
+Tags on unexported fields, which encoding/json ignores, and on fields of types
+encoding/json cannot marshal, e.g. channels, funcs and complex numbers, are
+reported as well.
+
+The options of json struct tags are checked against the options encoding/json
+understands, e.g. omitempty and string, and the type of the field. Malformed
+struct tags, which encoding/json silently ignores, are reported.
+
+With -requiretags, the values passed to the JSON response helpers named by the
+comma-separated -helpers flag, which defaults to WriteJSON, are checked for
+exported fields without a json struct tag, which encoding/json encodes with
+their Go name. All types reachable from the values are checked, and fields
+declared in other packages are reported at the call of the helper, unless
+their declaration ignores the untagged check.
+
+A check is suppressed for a single field with a directive in the field's
+comments, which must give a reason, e.g.
+  //jsontag:ignore name the key is part of a legacy API
+The checks are name, option, syntax, type, duplicate, consistency, untagged,
+mirror and marshaler.
+Directives that do not suppress any diagnostic are reported, unless their
+check is disabled, e.g. untagged without -requiretags. The legacy
+siamismatch tag option still disables the name check.
+
+With -snapshot, the json encoding of the exported struct types of a package,
+i.e. their keys, types and omitempty options, is compared to the snapshot file
+of that name in the package directory, if any. Removed or renamed keys, type
+changes and newly omitted keys are reported as breaking API compatibility.
+Intended changes are recorded by writing the snapshot files with the
+apisnapshot command, and checking them in with the package. Packages of the
+standard library and of versioned modules are not checked.
+
+Struct types that mirror a struct type of another package, e.g. the copy of a
+server response in a client package, should encode the same json keys with
+the same types. The mirrored type is named by a directive in the doc comment
+of the type, e.g.
+  //jsontag:mirror path/to/server.Response
+Keys of the mirrored type that are intentionally missing are ignored with a
+directive in the doc comment of the type, which names the key, e.g.
+  //jsontag:ignore mirror debug only used by the server
+or, for all types of the same name, by pairing the packages in the
+comma-separated -mirrors flag, e.g. path/to/client=path/to/server. Keys that
+are missing from either type and keys whose types differ are reported. The
+mirrored package must be imported by the package or its tests.
+
+Offending tags are rewritten by the suggested fixes, e.g. when run with -fix.`
 
 // Analyzer defines the jsontag analysis tool, allowing it to be used with the
 // analysis framework.
@@ -24,43 +104,270 @@ var Analyzer = &analysis.Analyzer{
 	Name:             "jsontag",
 	Doc:              Doc,
 	Requires:         []*analysis.Analyzer{inspect.Analyzer},
+	FactTypes:        []analysis.Fact{new(untaggedFact)},
 	RunDespiteErrors: true,
 	Run:              run,
 }
 
+// flagNaming is the default naming convention, see Doc.
+var flagNaming = string(namingLowercase)
+
+// flagIgnorePrefixes are the words that are ignored at the start of field and
+// tag names, see Doc. They default to the prefixes of the lockcheck
+// conventions, along with deprecated.
+var flagIgnorePrefixes = strings.Join(append(lockcheck.StaticFieldPrefixes(), lockcheck.ManagedMethodPrefixes()...), ",") + ",deprecated"
+
+// flagIgnoreSuffixes are the words that are ignored at the end of field and tag
+// names, see Doc.
+var flagIgnoreSuffixes = "deprecated"
+
+// flagKeys are the struct tag keys whose names are checked, see Doc.
+var flagKeys = "json"
+
+// flagRequireTags requires json struct tags on the fields of responses, see
+// Doc.
+var flagRequireTags bool
+
+// flagHelpers are the names of the JSON response helpers, see Doc.
+var flagHelpers = "WriteJSON"
+
+// flagSnapshot is the name of the API snapshot file in the package directory,
+// see Doc.
+var flagSnapshot string
+
+// flagMirrors are the pairs of packages whose struct types of the same name
+// mirror each other, see Doc.
+var flagMirrors string
+
+func init() {
+	Analyzer.Flags.StringVar(&flagNaming, "naming", flagNaming, "naming convention of json struct tags: lowercase, camel, snake or kebab")
+	Analyzer.Flags.StringVar(&flagIgnorePrefixes, "ignoreprefixes", flagIgnorePrefixes, "comma-separated words that are ignored at the start of field and tag names")
+	Analyzer.Flags.StringVar(&flagIgnoreSuffixes, "ignoresuffixes", flagIgnoreSuffixes, "comma-separated words that are ignored at the end of field and tag names")
+	Analyzer.Flags.StringVar(&flagKeys, "keys", flagKeys, "comma-separated struct tag keys whose names are checked, e.g. json,yaml,toml")
+	Analyzer.Flags.BoolVar(&flagRequireTags, "requiretags", false, "require json struct tags on the fields of values passed to the JSON response helpers")
+	Analyzer.Flags.StringVar(&flagHelpers, "helpers", flagHelpers, "comma-separated names of the JSON response helpers, e.g. WriteJSON")
+	Analyzer.Flags.StringVar(&flagSnapshot, "snapshot", "", "name of the API snapshot file in the package directory, e.g. api.json")
+	Analyzer.Flags.StringVar(&flagMirrors, "mirrors", "", "comma-separated pairs of package paths whose struct types of the same name mirror each other, e.g. path/to/client=path/to/server")
+}
+
 // run analyzes Go source code, reporting any violations of the jsontag checks.
 func run(pass *analysis.Pass) (interface{}, error) {
 	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
 
+	def, err := parseNaming(flagNaming)
+	if err != nil {
+		return nil, err
+	}
+	naming, err := packageNaming(pass.Files, def)
+	if err != nil {
+		return nil, err
+	}
+	conv := convention{
+		naming:   naming,
+		prefixes: splitList(flagIgnorePrefixes),
+		suffixes: splitList(flagIgnoreSuffixes),
+	}
+
+	keys := splitList(flagKeys)
+	enabled := enabledChecks(keys)
+	var untagged map[*types.Var]string
+	if flagRequireTags {
+		untagged = responseFields(pass, inspect, splitList(flagHelpers))
+	}
+	pairs, err := parseMirrors(flagMirrors)
+	if err != nil {
+		return nil, err
+	}
+	mirrors := mirroredTypes(pass, pairs)
+
+	// the struct tags of named types with custom marshalers are not used by
+	// encoding/json
+	named := make(map[*ast.StructType]*types.TypeName)
+	docs := make(map[*ast.StructType][]*ast.CommentGroup)
+	inspect.Preorder([]ast.Node{(*ast.GenDecl)(nil)}, func(n ast.Node) {
+		gd := n.(*ast.GenDecl)
+		for _, spec := range gd.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				if tn, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName); ok {
+					named[st] = tn
+					docs[st] = typeDocs(gd, ts)
+				}
+			}
+		}
+	})
+
 	nodeFilter := []ast.Node{
 		(*ast.StructType)(nil),
 	}
 	inspect.Preorder(nodeFilter, func(n ast.Node) {
-		styp, ok := pass.TypesInfo.Types[n.(*ast.StructType)].Type.(*types.Struct)
+		st := n.(*ast.StructType)
+		styp, ok := pass.TypesInfo.Types[st].Type.(*types.Struct)
 		if !ok {
 			return
 		}
+		fields := astFields(st)
+		r := newReporter(pass, st, enabled)
+		tn, ok := named[st]
+		if ok {
+			r.parseTypeIgnores(docs[st], tn.Pos())
+			if !checkMarshalers(r, tn) {
+				r.reportStale()
+				return
+			}
+		}
 		for i := 0; i < styp.NumFields(); i++ {
 			field := styp.Field(i)
-			tag, ok := reflect.StructTag(styp.Tag(i)).Lookup("json")
-			if !ok {
+			if _, err := parseTag(styp.Tag(i)); err != nil {
+				r.reportf(checkSyntax, field.Pos(), "malformed struct tag on field %s: %v", field.Name(), err)
 				continue
 			}
-			if strings.Contains(tag, "siamismatch") {
-				continue
+			if helper, ok := untagged[field]; ok {
+				expected := conv.tagName(field.Name())
+				r.report(checkUntagged, analysis.Diagnostic{
+					Pos:            field.Pos(),
+					Message:        fmt.Sprintf("field %s is encoded by %s without a json struct tag, expected %q", field.Name(), helper, expected),
+					SuggestedFixes: addTagFix(fields[i], "json", expected),
+				})
 			}
-			tag = removeOpts(tag)
-
-			if !matchesField(tag, field.Name()) {
-				pass.Reportf(field.Pos(), "json struct tag %q does not match field name %q", tag, field.Name())
-			} else if !isLowercase(tag) {
-				pass.Reportf(field.Pos(), "json struct tag %q should be all lowercase", tag)
+			if _, ok := reflect.StructTag(styp.Tag(i)).Lookup("json"); !ok && field.Exported() {
+				// the field may be encoded by the JSON response helpers of
+				// other packages, which import the directive as a fact
+				if ig := r.suppress(checkUntagged, field.Pos()); ig != nil {
+					pass.ExportObjectFact(field, &untaggedFact{Reason: ig.reason})
+				}
 			}
+			tags := reflect.StructTag(styp.Tag(i))
+			jsonTag, ok := tags.Lookup("json")
+			jsonName := removeOpts(jsonTag)
+			checkJSONName := ok && checkJSON(r, field, fields[i], jsonTag)
+			for _, key := range keys {
+				if key == "json" {
+					if checkJSONName {
+						checkTagName(r, conv, key, field, fields[i], jsonName)
+					}
+					continue
+				}
+				// tags without a name use the name of the field, inlined
+				// fields have no name of their own
+				tag, ok := tags.Lookup(key)
+				if !ok || tag == "-" || removeOpts(tag) == "" || hasOption(tag, "inline") {
+					continue
+				}
+				if jsonName != "" && jsonName != "-" {
+					checkTagConsistency(r, key, field, fields[i], removeOpts(tag), jsonName)
+				} else {
+					checkTagName(r, conv, key, field, fields[i], removeOpts(tag))
+				}
+			}
+		}
+		checkDuplicates(r, styp)
+		if mirror, ok := mirrors[tn]; ok {
+			r.enable(checkMirror)
+			compareMirror(r, tn, mirror)
 		}
+		r.reportStale()
 	})
+
+	if flagSnapshot != "" {
+		if err := checkSnapshot(pass); err != nil {
+			return nil, err
+		}
+	}
 	return nil, nil
 }
 
+// checkJSON checks the json struct tag of field, declared by decl, reporting
+// whether the name of the tag should be checked as well.
+func checkJSON(r *reporter, field *types.Var, decl *ast.Field, tag string) bool {
+	if tag == "-" {
+		return false
+	}
+	if !field.Exported() && !field.Anonymous() {
+		r.reportf(checkType, field.Pos(), "json struct tag on unexported field %s, which encoding/json ignores", field.Name())
+		return false
+	}
+	if t := unsupportedType(field.Type()); t != nil {
+		r.reportf(checkType, field.Pos(), "json struct tag on field %s of type %s, which encoding/json cannot marshal", field.Name(), types.TypeString(t, types.RelativeTo(r.pass.Pkg)))
+	}
+	checkOptions(r, field, decl, tag)
+	if hasOption(tag, "siamismatch") {
+		return false
+	}
+	if strings.HasPrefix(tag, "-,") {
+		r.reportf(checkName, field.Pos(), "json struct tag %q sets the key \"-\", use \"-\" to omit field %s", tag, field.Name())
+		return false
+	}
+	if name := removeOpts(tag); !isValidTagName(name) {
+		r.reportf(checkName, field.Pos(), "json struct tag %q contains characters encoding/json does not allow, field name %q is used instead", name, field.Name())
+		return false
+	}
+	return true
+}
+
+// checkTagName checks that the name of the struct tag with the given key of
+// field, declared by decl, follows the naming convention. Ignorable words may
+// be part of both the field name and the tag name.
+func checkTagName(r *reporter, c convention, key string, field *types.Var, decl *ast.Field, name string) {
+	expected := c.tagName(field.Name())
+	tag := c.trimTag(name)
+	if !matchesField(tag, expected, c.naming) {
+		tag = name
+		if !matchesField(name, c.naming.tagName(field.Name()), c.naming) {
+			r.report(checkName, analysis.Diagnostic{
+				Pos:            field.Pos(),
+				Message:        fmt.Sprintf("%s struct tag %q does not match field name %q, expected %q", key, name, field.Name(), expected),
+				SuggestedFixes: renameFix(decl, key, expected),
+			})
+			return
+		}
+	}
+	if !isLowercase(tag) && c.naming == namingLowercase {
+		// a tag keeping the ignored words should keep them in lowercase, e.g.
+		// callid rather than id for CallID
+		if full := c.naming.tagName(field.Name()); matchesField(name, full, c.naming) {
+			expected = full
+		}
+		r.report(checkName, analysis.Diagnostic{
+			Pos:            field.Pos(),
+			Message:        fmt.Sprintf("%s struct tag %q should be all lowercase, expected %q", key, name, expected),
+			SuggestedFixes: renameFix(decl, key, expected),
+		})
+	}
+}
+
+// checkTagConsistency checks that the name of the struct tag with the given key
+// of field, declared by decl, agrees with the name of its json struct tag.
+func checkTagConsistency(r *reporter, key string, field *types.Var, decl *ast.Field, name, jsonName string) {
+	if name == jsonName {
+		return
+	}
+	r.report(checkConsistency, analysis.Diagnostic{
+		Pos:            field.Pos(),
+		Message:        fmt.Sprintf("%s struct tag %q of field %s does not agree with json struct tag %q", key, name, field.Name(), jsonName),
+		SuggestedFixes: renameFix(decl, key, jsonName),
+	})
+}
+
+// astFields returns the ast.Field declaring each field of st, in the order of
+// the fields of the corresponding types.Struct. A declaration of multiple
+// fields, e.g. a, b int, appears once for each of its fields.
+func astFields(st *ast.StructType) []*ast.Field {
+	var fields []*ast.Field
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			fields = append(fields, f) // embedded field
+		}
+		for range f.Names {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
 // removeOpts removes any "options" from a JSON struct tag, leaving only the
 // field name.
 func removeOpts(tag string) string {
@@ -70,15 +377,14 @@ func removeOpts(tag string) string {
 	return tag
 }
 
-// matchesField checks whether the name of a JSON struct tag matches the name of
-// the Go struct field it is attached to.
-func matchesField(tag, field string) bool {
-	tag, field = strings.ToLower(tag), strings.ToLower(field)
-
-	// naming conventions are omitted from the comparison
-	field = strings.TrimPrefix(field, "static")
-
-	return tag == field
+// matchesField checks whether the name of a JSON struct tag matches the name
+// expected for the Go struct field it is attached to. Using the lowercase
+// naming convention, casing is checked separately by isLowercase.
+func matchesField(tag, expected string, n naming) bool {
+	if n == namingLowercase {
+		return strings.ToLower(tag) == expected
+	}
+	return tag == expected
 }
 
 // isLowercase checks whether a tag name is entirely lowercase.
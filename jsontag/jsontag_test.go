@@ -1,6 +1,10 @@
 package jsontag_test
 
 import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"testing"
 
 	"gitlab.com/NebulousLabs/analyze/jsontag"
@@ -13,20 +17,643 @@ func Test(t *testing.T) {
 type Foo struct {
 	a int // OK
 
-	b int "json:\"b\"" // OK
+	B int "json:\"b\"" // OK
 	C int "json:\"c\"" // OK
 	D int "json:\"d,omitempty\"" // OK
-	e int "json:\"E\"" // want "json struct tag \"E\" should be all lowercase"
-	f int "json:\"g\"" // want "json struct tag \"g\" does not match field name \"f\""
+	E int "json:\"E\"" // want "json struct tag \"E\" should be all lowercase"
+	F int "json:\"g\"" // want "json struct tag \"g\" does not match field name \"F\""
 
-	g int "json:\"h,siamismatch\"" // OK
+	G int "json:\"k,siamismatch\"" // OK
 
 	StaticH     int "json:\"h,omitempty\"" // OK
-	DeprecatedI int "json:\"iDeprecated,siamismatch\"" // OK
+	DeprecatedI int "json:\"iDeprecated\""             // OK
 
-	j int "json:\"j,string,foo,bar\"" // OK
+	J int "json:\"j,string,foo,bar\"" // want "unknown json struct tag option \"foo\"" "unknown json struct tag option \"bar\""
+
+	l int "json:\"l\"" // want "json struct tag on unexported field l, which encoding/json ignores"
+	m int "json:\"-\"" // OK
+}
+
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, jsontag.Analyzer, "a")
+}
+
+// TestSuggestedFixes tests that the suggested fixes rewrite the offending
+// struct tags, preserving options and other keys.
+func TestSuggestedFixes(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+type Foo struct {
+	A int ` + "`json:\"b\"`" + ` // want "json struct tag \"b\" does not match field name \"A\""
+	B int ` + "`json:\"B,omitempty\" yaml:\"b\"`" + ` // want "json struct tag \"B\" should be all lowercase"
+	C int "json:\"d,string\"" // want "json struct tag \"d\" does not match field name \"C\""
+
+	StaticE int ` + "`yaml:\"e\" json:\"f\"`" + ` // want "json struct tag \"f\" does not match field name \"StaticE\""
+}
+`, "a/a.go.golden": `package a
+
+type Foo struct {
+	A int ` + "`json:\"a\"`" + `                    // want "json struct tag \"b\" does not match field name \"A\""
+	B int ` + "`json:\"b,omitempty\" yaml:\"b\"`" + ` // want "json struct tag \"B\" should be all lowercase"
+	C int "json:\"c,string\""           // want "json struct tag \"d\" does not match field name \"C\""
+
+	StaticE int ` + "`yaml:\"e\" json:\"e\"`" + ` // want "json struct tag \"f\" does not match field name \"StaticE\""
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.RunWithSuggestedFixes(t, dir, jsontag.Analyzer, "a")
+}
+
+// TestNaming tests the naming conventions, selected both by directive and by
+// flag.
+func TestNaming(t *testing.T) {
+	files := map[string]string{"snake/snake.go": `package snake
+
+//jsontag:naming snake
+
+type Foo struct {
+	UserID        int "json:\"user_id\""                     // OK
+	HTTPServerURL int "json:\"http_server_url,omitempty\""   // OK
+	StaticName    int "json:\"name\""                        // OK
+	Address       int "json:\"addr\""                        // want "json struct tag \"addr\" does not match field name \"Address\", expected \"address\""
+	CreatedAt     int "json:\"createdAt\""                   // want "json struct tag \"createdAt\" does not match field name \"CreatedAt\", expected \"created_at\""
+}
+`, "camel/camel.go": `package camel
+
+type Foo struct {
+	UserID    int "json:\"userId\""    // OK
+	HostIDs   int "json:\"hostIds\""   // OK
+	CreatedAt int "json:\"created_at\"" // want "json struct tag \"created_at\" does not match field name \"CreatedAt\", expected \"createdAt\""
+	Name      int "json:\"Name\""       // want "json struct tag \"Name\" does not match field name \"Name\", expected \"name\""
+}
+`, "kebab/kebab.go": `package kebab
+
+//jsontag:naming kebab
+
+type Foo struct {
+	UserID  int "json:\"user-id\""  // OK
+	HostIDs int "json:\"host_ids\"" // want "json struct tag \"host_ids\" does not match field name \"HostIDs\", expected \"host-ids\""
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, jsontag.Analyzer, "snake", "kebab")
+
+	if err := jsontag.Analyzer.Flags.Set("naming", "camel"); err != nil {
+		t.Fatal(err)
+	}
+	defer jsontag.Analyzer.Flags.Set("naming", "lowercase")
+	analysistest.Run(t, dir, jsontag.Analyzer, "camel")
+}
+
+// TestIgnoredWords tests that the ignored prefixes, which default to the
+// prefixes of the lockcheck conventions and deprecated, are ignored at the start of field and
+// tag names, and that the ignored suffixes, which default to deprecated, are
+// ignored at their end.
+func TestIgnoredWords(t *testing.T) {
+	files := map[string]string{"defaults/defaults.go": `package defaults
+
+type Foo struct {
+	StaticA      int "json:\"a\""           // OK
+	AtomicB      int "json:\"b\""           // OK
+	ExternC      int "json:\"externc\""     // OK
+	ManagedD     int "json:\"d\""           // OK
+	ThreadedE    int "json:\"e\""           // OK
+	CallF        int "json:\"f\""           // OK
+	GDeprecated  int "json:\"gDeprecated\"" // OK
+	HDeprecated  int "json:\"h\""           // OK
+	StaticI      int "json:\"atomicI\""     // OK
+	StaticJ      int "json:\"staticK\""     // want "json struct tag \"staticK\" does not match field name \"StaticJ\", expected \"j\""
+	LegacyL      int "json:\"l\""           // want "json struct tag \"l\" does not match field name \"LegacyL\", expected \"legacyl\""
+	AtomicStatic int "json:\"Static\""      // want "json struct tag \"Static\" should be all lowercase, expected \"static\""
+	LastCall     int "json:\"last\""        // want "json struct tag \"last\" does not match field name \"LastCall\", expected \"lastcall\""
+	HostStatic   int "json:\"hoststatic\""  // OK
+	M            int "json:\"m_call\""      // want "json struct tag \"m_call\" does not match field name \"M\", expected \"m\""
+	N            int "json:\"nAtomic\""     // want "json struct tag \"nAtomic\" does not match field name \"N\", expected \"n\""
+	DeprecatedO  int "json:\"oDeprecated\"" // OK
+	CallID       int "json:\"CallID\""      // want "json struct tag \"CallID\" should be all lowercase, expected \"callid\""
+	StaticP      int "json:\"P\""           // want "json struct tag \"P\" should be all lowercase, expected \"p\""
+}
+`, "custom/custom.go": `package custom
+
+type Foo struct {
+	LegacyA int "json:\"a\""       // OK
+	BOld    int "json:\"b\""       // OK
+	StaticC int "json:\"c\""       // want "json struct tag \"c\" does not match field name \"StaticC\", expected \"staticc\""
+	StaticD int "json:\"staticd\"" // OK
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, jsontag.Analyzer, "defaults")
+
+	for flag, value := range map[string]string{"ignoreprefixes": "legacy", "ignoresuffixes": "old"} {
+		def := jsontag.Analyzer.Flags.Lookup(flag).DefValue
+		if err := jsontag.Analyzer.Flags.Set(flag, value); err != nil {
+			t.Fatal(err)
+		}
+		defer jsontag.Analyzer.Flags.Set(flag, def)
+	}
+	analysistest.Run(t, dir, jsontag.Analyzer, "custom")
+}
+
+// TestDuplicates tests that fields with duplicate json keys are reported,
+// including fields promoted from embedded structs.
+func TestDuplicates(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+type Foo struct {
+	A int "json:\"a\""
+	B int "json:\"a\"" // want "json struct tag \"a\" does not match field name \"B\"" "json key \"a\" of field B conflicts with field A, encoding/json drops both"
+	C int "json:\"-\"" // OK
+	D int "json:\"-\"" // OK
+	b int "json:\"b\"" // want "json struct tag on unexported field b"
+}
+
+type Inner struct {
+	Name string "json:\"name\""
+	ID   string "json:\"id\""
+	Size int
+}
+
+type inner struct {
+	Hidden int "json:\"hidden\""
+}
+
+type Outer struct {
+	Inner // want "json key \"name\" of field Inner.Name is shadowed by field Name" "json key \"Size\" of field Inner.Size is shadowed by field Other"
+	*inner // OK
+	Name  string "json:\"name\""
+	Other int    "json:\"Size,siamismatch\""
+}
+
+type Other struct {
+	ID string "json:\"id\""
+}
+
+type Both struct {
+	Inner
+	Other // want "json key \"id\" of field Other.ID conflicts with field Inner.ID, encoding/json drops both"
+}
+
+type Tagged struct {
+	Upper
+	Untagged // want "json key \"Name\" of field Untagged.Name is shadowed by field Upper.Name"
+}
+
+type Upper struct {
+	Name string "json:\"Name,siamismatch\""
+}
+
+type Untagged struct {
+	Name string
+}
+
+type Nested struct {
+	Outer  // want "json key \"name\" of field Outer.Name is shadowed by field Name" "json key \"hidden\" of field Outer.inner.Hidden is shadowed by field Hidden"
+	Name   string "json:\"name\""
+	Hidden int    "json:\"hidden\""
+}
+
+type Embedded struct {
+	Inner "json:\"inner\"" // OK
+	Name string "json:\"name\""
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, jsontag.Analyzer, "a")
+}
+
+// TestUnsupportedTypes tests that tags on fields of types encoding/json cannot
+// marshal are reported.
+func TestUnsupportedTypes(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+import "unsafe"
+
+type Key struct{} // want "Key implements encoding.TextMarshaler but not encoding.TextUnmarshaler"
+
+func (Key) MarshalText() ([]byte, error) { return nil, nil }
+
+type Func func()
+
+func (*Func) MarshalJSON() ([]byte, error) { return nil, nil }
+
+type Foo struct {
+	A chan int              "json:\"a\"" // want "json struct tag on field A of type chan int, which encoding/json cannot marshal"
+	B func()                "json:\"b\"" // want "json struct tag on field B of type func\\(\\), which encoding/json cannot marshal"
+	C complex128            "json:\"c\"" // want "json struct tag on field C of type complex128"
+	D unsafe.Pointer        "json:\"d\"" // want "json struct tag on field D of type unsafe.Pointer"
+	E map[[2]int]string     "json:\"e\"" // want "json struct tag on field E of type map\\[\\[2\\]int\\]string"
+	F []map[string]chan int "json:\"f\"" // want "json struct tag on field F of type chan int"
+	G *[]complex64          "json:\"g\"" // want "json struct tag on field G of type complex64"
+
+	H map[int]string       "json:\"h\"" // OK
+	I map[Key][]string     "json:\"i\"" // OK
+	J Func                 "json:\"j\"" // OK
+	K chan int             "json:\"-\"" // OK
+	L interface{}          "json:\"l\"" // OK
+	M struct{ C chan int } "json:\"m\"" // OK, checked in the struct itself
+	N chan int             // OK, untagged
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, jsontag.Analyzer, "a")
+}
+
+// TestOptions tests that the options and syntax of struct tags are checked.
+func TestOptions(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+type Foo struct {
+	A int      "json:\"a,omitempty\""             // OK
+	B int      "json:\"b,omitemtpy\""             // want "unknown json struct tag option \"omitemtpy\", did you mean \"omitempty\"\\?"
+	C int      "json:\"c,omitempty,omitempty\""   // want "json struct tag option \"omitempty\" is repeated"
+	D int      "json:\"d,strign\""                // want "unknown json struct tag option \"strign\", did you mean \"string\"\\?"
+	E []int    "json:\"e,string\""                // want "json struct tag option \"string\" on field E of type \\[\\]int, which only applies to strings, numbers and booleans"
+	F *float64 "json:\"f,string,omitzero\""       // OK
+	G bool     "json:\"g,\""                      // OK
+	H int      "json:\"-,\""                      // want "json struct tag \"-,\" sets the key \"-\", use \"-\" to omit field H"
+	I int      "json:\"i'\""                      // want "json struct tag \"i'\" contains characters encoding/json does not allow, field name \"I\" is used instead"
+	J int      "json:j"                           // want "malformed struct tag on field J: bad syntax for struct tag pair \"json:j\""
+	K int      "json:\"k\"yaml:\"k\""             // want "malformed struct tag on field K: key:\"value\" pairs not separated by spaces"
+	L int      "json:\"l\" json:\"l\""            // want "malformed struct tag on field L: struct tag key \"json\" is repeated"
+}
+`, "b/b.go": `package b
+
+type Foo struct {
+	A int "json:\"a,omitemtpy\" yaml:\"a\"" // want "unknown json struct tag option"
+}
+`, "b/b.go.golden": `package b
+
+type Foo struct {
+	A int "json:\"a,omitempty\" yaml:\"a\"" // want "unknown json struct tag option"
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, jsontag.Analyzer, "a")
+	analysistest.RunWithSuggestedFixes(t, dir, jsontag.Analyzer, "b")
+}
+
+// TestIgnore tests that checks are suppressed by the ignore directive, and
+// that malformed and stale directives are reported.
+func TestIgnore(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+type Inner struct {
+	Name string "json:\"name\""
+}
+
+type Foo struct {
+	//jsontag:ignore name the key is part of a legacy API
+	A int "json:\"b\"" // OK
+
+	B int "json:\"B\"" //jsontag:ignore name clients depend on the casing
+
+	//jsontag:ignore option decoded by a custom decoder
+	C int "json:\"c,omitemtpy\"" // OK
+
+	//jsontag:ignore duplicate the inner name is never set
+	Inner
+	Name string "json:\"name\""
+
+	/* want "jsontag:ignore directive for check \"name\" requires a reason" */ //jsontag:ignore name
+	D int "json:\"e\"" // want "json struct tag \"e\" does not match field name \"D\""
+
+	/* want "jsontag:ignore directive names unknown check \"nmae\", expected one of name, option, syntax, type, duplicate" */ //jsontag:ignore nmae the key is part of a legacy API
+	F int "json:\"g\"" // want "json struct tag \"g\" does not match field name \"F\""
+
+	/* want "jsontag:ignore directive for check \"option\" does not suppress any diagnostic" */ //jsontag:ignore option no option to ignore
+	H int "json:\"i\"" // want "json struct tag \"i\" does not match field name \"H\""
+
+	//jsontag:ignore type a tagged channel
+	J chan int "json:\"j\"" // OK
+
+	//jsontag:ignore untagged only checked with -requiretags
+	K int "json:\"k\"" // OK
+
+	//jsontag:ignore consistency only checked with other keys
+	L int "json:\"l\"" // OK
+}
+`, "b/b.go": `package b
+
+type Foo struct {
+	/* want "jsontag:ignore directive for check \"consistency\" does not suppress any diagnostic" */ //jsontag:ignore consistency no yaml struct tag
+	A int "json:\"a\""
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, jsontag.Analyzer, "a")
+
+	if err := jsontag.Analyzer.Flags.Set("keys", "json,yaml"); err != nil {
+		t.Fatal(err)
+	}
+	defer jsontag.Analyzer.Flags.Set("keys", "json")
+	analysistest.Run(t, dir, jsontag.Analyzer, "b")
+}
+
+// TestSnapshot tests that changes to the json encoding of exported types that
+// break API compatibility are reported, including changes to nested structs.
+func TestSnapshot(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a // want "type Removed of the API snapshot api.json was removed, which breaks API compatibility"
+
+import "time"
+
+type User struct { // want "json key \"email\" of User was removed or renamed, which breaks API compatibility"
+	ID      int       "json:\"id\""
+	Name    []string  "json:\"name\""           // want "json key \"name\" of User changed type from string to \\[\\]string, which breaks API compatibility"
+	Age     int       "json:\"age,omitempty\""  // want "json key \"age\" of User is now omitted when empty, which breaks API compatibility"
+	Created time.Time "json:\"created\""
+	Count   int64     "json:\"count,string\""
+	Added   int       "json:\"added\""
+	Info    struct {  // want "json key \"info\" of User changed type from object{a string} to object{a number}, which breaks API compatibility"
+		A int "json:\"a\""
+	} "json:\"info\""
+	Owner   *Added    "json:\"owner\""        // want "json key \"owner\" of User changed type from object Account to object Added, which breaks API compatibility"
+	Items   []item    "json:\"items\""
+}
+
+type item struct {
+	B string "json:\"b\""
+}
+
+type Added struct {
+	A int "json:\"a\""
+}
+`, "a/api.json": `{
+	"Removed": {},
+	"User": {
+		"id": {"type": "number", "omitempty": false},
+		"email": {"type": "string", "omitempty": false},
+		"name": {"type": "string", "omitempty": false},
+		"age": {"type": "number", "omitempty": false},
+		"created": {"type": "opaque time.Time", "omitempty": false},
+		"count": {"type": "string", "omitempty": true},
+		"info": {"type": "object{a string}", "omitempty": false},
+		"owner": {"type": "object Account", "omitempty": false},
+		"items": {"type": "[]object{b string}", "omitempty": false}
+	}
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if err := jsontag.Analyzer.Flags.Set("snapshot", "api.json"); err != nil {
+		t.Fatal(err)
+	}
+	defer jsontag.Analyzer.Flags.Set("snapshot", "")
+	analysistest.Run(t, dir, jsontag.Analyzer, "a")
+}
+
+// TestWriteSnapshot tests the snapshot files written for a package.
+func TestWriteSnapshot(t *testing.T) {
+	src := `package b
+
+type Base struct {
+	ID int "json:\"id\""
+}
+
+type Item struct {
+	Base
+	Tags  []string          "json:\"tags,omitempty\""
+	Data  []byte            "json:\"data\""
+	Price float64           "json:\"price,string\""
+	Meta  map[string][]bool "json:\"meta\""
+	Next  *Item             "json:\"next\""
+	Tree  tree              "json:\"tree\""
+}
+
+type tree struct {
+	Children []tree "json:\"children,omitempty\""
+}
+
+type unexported struct {
+	A int "json:\"a\""
+}
+
+type Opaque struct {
+	A int "json:\"a\""
+}
+
+func (Opaque) MarshalJSON() ([]byte, error) { return nil, nil }
+
+func (*Opaque) UnmarshalJSON([]byte) error { return nil }
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "b.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("b", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := jsontag.Snapshot(fset, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+	"Base": {
+		"id": {
+			"type": "number",
+			"omitempty": false
+		}
+	},
+	"Item": {
+		"data": {
+			"type": "string",
+			"omitempty": false
+		},
+		"id": {
+			"type": "number",
+			"omitempty": false
+		},
+		"meta": {
+			"type": "map[string][]boolean",
+			"omitempty": false
+		},
+		"next": {
+			"type": "object Item",
+			"omitempty": false
+		},
+		"price": {
+			"type": "string",
+			"omitempty": false
+		},
+		"tags": {
+			"type": "[]string",
+			"omitempty": true
+		},
+		"tree": {
+			"type": "object{children,omitempty []object tree}",
+			"omitempty": false
+		}
+	}
+}
+`
+	if string(b) != expected {
+		t.Errorf("unexpected snapshot:\n%s\nexpected:\n%s", b, expected)
+	}
+}
+
+// TestKeys tests that the names of other struct tag keys are checked, and agree
+// with the json struct tag.
+func TestKeys(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+type Foo struct {
+	A int ` + "`json:\"a\" yaml:\"a\"`" + ` // OK
+	B int ` + "`json:\"b\" yaml:\"c\"`" + ` // want "yaml struct tag \"c\" of field B does not agree with json struct tag \"b\""
+	C int ` + "`yaml:\"d\"`" + `           // want "yaml struct tag \"d\" does not match field name \"C\", expected \"c\""
+	D int ` + "`yaml:\"D\" toml:\"d\"`" + ` // want "yaml struct tag \"D\" should be all lowercase, expected \"d\""
+	E int ` + "`json:\"-\" yaml:\"e\"`" + ` // OK
+	F int ` + "`json:\"g,siamismatch\" yaml:\"g\"`" + ` // OK
+	H int ` + "`json:\"h\" yaml:\"-\"`" + ` // OK
+	I int ` + "`json:\"i\" toml:\"j\"`" + ` // OK, toml is not checked
+
+	//jsontag:ignore consistency the yaml key is part of a legacy config
+	J int ` + "`json:\"j\" yaml:\"k\"`" + `
+
+	K int  ` + "`json:\"k\" yaml:\",omitempty\"`" + `   // OK
+	L Base ` + "`json:\"l\" yaml:\",inline\"`" + `     // OK
+	M int  ` + "`yaml:\",omitempty\"`" + `             // OK
+	N Base ` + "`json:\"n\" yaml:\"other,inline\"`" + ` // OK
+}
+
+type Base struct {
+	X int ` + "`json:\"x\" yaml:\"x\"`" + ` // OK
+}
+`, "a/a.go.golden": `package a
+
+type Foo struct {
+	A int ` + "`json:\"a\" yaml:\"a\"`" + ` // OK
+	B int ` + "`json:\"b\" yaml:\"b\"`" + ` // want "yaml struct tag \"c\" of field B does not agree with json struct tag \"b\""
+	C int ` + "`yaml:\"c\"`" + `           // want "yaml struct tag \"d\" does not match field name \"C\", expected \"c\""
+	D int ` + "`yaml:\"d\" toml:\"d\"`" + ` // want "yaml struct tag \"D\" should be all lowercase, expected \"d\""
+	E int ` + "`json:\"-\" yaml:\"e\"`" + ` // OK
+	F int ` + "`json:\"g,siamismatch\" yaml:\"g\"`" + ` // OK
+	H int ` + "`json:\"h\" yaml:\"-\"`" + ` // OK
+	I int ` + "`json:\"i\" toml:\"j\"`" + ` // OK, toml is not checked
+
+	//jsontag:ignore consistency the yaml key is part of a legacy config
+	J int ` + "`json:\"j\" yaml:\"k\"`" + `
+
+	K int  ` + "`json:\"k\" yaml:\",omitempty\"`" + `   // OK
+	L Base ` + "`json:\"l\" yaml:\",inline\"`" + `     // OK
+	M int  ` + "`yaml:\",omitempty\"`" + `             // OK
+	N Base ` + "`json:\"n\" yaml:\"other,inline\"`" + ` // OK
+}
+
+type Base struct {
+	X int ` + "`json:\"x\" yaml:\"x\"`" + ` // OK
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if err := jsontag.Analyzer.Flags.Set("keys", "json,yaml"); err != nil {
+		t.Fatal(err)
+	}
+	defer jsontag.Analyzer.Flags.Set("keys", "json")
+	analysistest.RunWithSuggestedFixes(t, dir, jsontag.Analyzer, "a")
+}
+
+// TestMarshalers tests that struct types with custom marshalers are skipped,
+// and that types implementing only one of a marshaler and an unmarshaler are
+// reported.
+func TestMarshalers(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+import "time"
+
+type Both struct {
+	A int "json:\"b\"" // OK, not used by encoding/json
+}
+
+func (Both) MarshalJSON() ([]byte, error) { return nil, nil }
+
+func (*Both) UnmarshalJSON([]byte) error { return nil }
+
+type Text struct {
+	A int "json:\"b\"" // OK, not used by encoding/json
 }
 
+func (*Text) MarshalText() ([]byte, error) { return nil, nil }
+
+func (*Text) UnmarshalText([]byte) error { return nil }
+
+type Marshal struct { // want "Marshal implements json.Marshaler but not json.Unmarshaler"
+	A int "json:\"b\"" // want "json struct tag \"b\" does not match field name \"A\""
+}
+
+func (Marshal) MarshalJSON() ([]byte, error) { return nil, nil }
+
+type Unmarshal struct { // want "Unmarshal implements json.Unmarshaler but not json.Marshaler"
+	A int "json:\"b\"" // want "json struct tag \"b\" does not match field name \"A\""
+}
+
+func (*Unmarshal) UnmarshalJSON([]byte) error { return nil }
+
+// Encoded is only ever encoded.
+//
+//jsontag:ignore marshaler the decoded form is never read
+type Encoded struct {
+	A int "json:\"a\"" // OK
+}
+
+func (Encoded) MarshalJSON() ([]byte, error) { return nil, nil }
+
+/* want "jsontag:ignore directive for check \"marshaler\" does not suppress any diagnostic" */ //jsontag:ignore marshaler both are implemented
+type Symmetric struct {
+	A int "json:\"b\"" // OK, not used by encoding/json
+}
+
+func (Symmetric) MarshalJSON() ([]byte, error) { return nil, nil }
+
+func (*Symmetric) UnmarshalJSON([]byte) error { return nil }
+
+type Embedded struct {
+	time.Time
+	A int "json:\"b\"" // OK, encoding/json uses the methods of time.Time
+}
 `}
 	dir, cleanup, err := analysistest.WriteFiles(files)
 	if err != nil {
@@ -35,3 +662,312 @@ type Foo struct {
 	defer cleanup()
 	analysistest.Run(t, dir, jsontag.Analyzer, "a")
 }
+
+// TestRequireTags tests that fields of values passed to the JSON response
+// helpers are required to have a json struct tag.
+func TestRequireTags(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+import "b"
+
+func WriteJSON(w interface{}, v interface{}) {}
+
+type Base struct {
+	Version int // want "field Version is encoded by WriteJSON without a json struct tag, expected \"version\""
+}
+
+type Item struct {
+	Name string // want "field Name is encoded by WriteJSON"
+}
+
+type Response struct {
+	Base
+	ID       int "json:\"id\""
+	UserName string ` + "`yaml:\"username\"`" + ` // want "field UserName is encoded by WriteJSON"
+	Items    []*Item        "json:\"items\""
+	ByName   map[string]Item "json:\"byname\""
+	Skipped  struct{ A int } "json:\"-\""
+	Foreign  b.Foreign      "json:\"foreign\""
+	hidden   struct{ B int }
+
+	//jsontag:ignore untagged decoded case-insensitively by our clients
+	Legacy int // want Legacy:"ignores untagged: decoded case-insensitively by our clients"
+}
+
+type Other struct {
+	NotEncoded int
+}
+
+func handler(w interface{}) {
+	WriteJSON(w, Response{}) // want "field Untagged of b.Foreign is encoded by WriteJSON without a json struct tag"
+}
+`, "a/a.go.golden": `package a
+
+import "b"
+
+func WriteJSON(w interface{}, v interface{}) {}
+
+type Base struct {
+	Version int ` + "`json:\"version\"`" + ` // want "field Version is encoded by WriteJSON without a json struct tag, expected \"version\""
+}
+
+type Item struct {
+	Name string ` + "`json:\"name\"`" + ` // want "field Name is encoded by WriteJSON"
+}
+
+type Response struct {
+	Base
+	ID       int                                    "json:\"id\""
+	UserName string ` + "`json:\"username\" yaml:\"username\"`" + ` // want "field UserName is encoded by WriteJSON"
+	Items    []*Item                                "json:\"items\""
+	ByName   map[string]Item                        "json:\"byname\""
+	Skipped  struct{ A int }                        "json:\"-\""
+	Foreign  b.Foreign                              "json:\"foreign\""
+	hidden   struct{ B int }
+
+	//jsontag:ignore untagged decoded case-insensitively by our clients
+	Legacy int // want Legacy:"ignores untagged: decoded case-insensitively by our clients"
+}
+
+type Other struct {
+	NotEncoded int
+}
+
+func handler(w interface{}) {
+	WriteJSON(w, Response{}) // want "field Untagged of b.Foreign is encoded by WriteJSON without a json struct tag"
+}
+`, "b/b.go": `package b
+
+type Foreign struct {
+	Tagged   int "json:\"tagged\""
+	Untagged int
+
+	//jsontag:ignore untagged decoded case-insensitively by our clients
+	Ignored int // want Ignored:"ignores untagged: decoded case-insensitively by our clients"
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if err := jsontag.Analyzer.Flags.Set("requiretags", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer jsontag.Analyzer.Flags.Set("requiretags", "false")
+	analysistest.RunWithSuggestedFixes(t, dir, jsontag.Analyzer, "a")
+	analysistest.Run(t, dir, jsontag.Analyzer, "b")
+}
+
+// TestGenerics tests that the fields of generic struct types, and of struct
+// types in type parameter constraints and instantiations, are checked, and
+// that each field is reported once, however often its type is instantiated.
+func TestGenerics(t *testing.T) {
+	files := map[string]string{"generic/generic.go": `package generic
+
+import "other"
+
+type Base[T any] struct {
+	ID    T "json:\"id\""
+	Value T "json:\"Value\"" // want "json struct tag \"Value\" should be all lowercase"
+	Ch    chan T "json:\"ch\"" // want "json struct tag on field Ch of type chan T, which encoding/json cannot marshal"
+}
+
+type Pair[K comparable, V any] struct {
+	Key   K "json:\"key\""
+	Value V "json:\"v\"" // want "json struct tag \"v\" does not match field name \"Value\""
+}
+
+type Foo struct {
+	Base[int] // want "json key \"id\" of field Base.ID is shadowed by field ID"
+	ID string "json:\"id\""
+}
+
+type Bar struct {
+	*Pair[string, int] // want "json key \"key\" of field Pair.Key is shadowed by field Key"
+	Key int "json:\"key\""
+}
+
+type Baz struct {
+	//jsontag:ignore duplicate the embedded id is legacy
+	Base[string]
+	ID string "json:\"id\""
+}
+
+type Qux struct {
+	//jsontag:ignore duplicate the embedded id is legacy
+	*other.Base[int]
+	ID string "json:\"id\""
+}
+
+type Quux struct {
+	//jsontag:ignore duplicate the embedded key is legacy
+	other.Pair[int, int]
+	Key string "json:\"key\""
+}
+
+type Constrained[T interface{ ~struct{ A int "json:\"b\"" } }] struct { // want "json struct tag \"b\" does not match field name \"A\""
+	Inner T "json:\"inner\""
+}
+
+var (
+	_ = Base[struct{ C int "json:\"d\"" }]{}   // want "json struct tag \"d\" does not match field name \"C\""
+	_ = Base[struct{ C int "json:\"c\"" }]{}
+	_ = Pair[string, Base[float64]]{}
+)
+`, "other/other.go": `package other
+
+type Base[T any] struct {
+	ID T "json:\"id\""
+}
+
+type Pair[K, V any] struct {
+	Key   K "json:\"key\""
+	Value V "json:\"value\""
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, jsontag.Analyzer, "generic")
+}
+
+// TestGenericResponses tests that the untagged fields of generic struct types
+// are reported once, however often they are encoded by the JSON response
+// helpers.
+func TestGenericResponses(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+func WriteJSON(w interface{}, v interface{}) {}
+
+type Page[T any] struct {
+	Items []T "json:\"items\""
+	Total int // want "field Total is encoded by WriteJSON without a json struct tag, expected \"total\""
+	Next  *T  // want "field Next is encoded by WriteJSON without a json struct tag, expected \"next\""
+}
+
+type Item struct {
+	Name string // want "field Name is encoded by WriteJSON"
+}
+
+func handler(w interface{}) {
+	WriteJSON(w, Page[Item]{})
+	WriteJSON(w, Page[string]{})
+	WriteJSON(w, &Page[Item]{})
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if err := jsontag.Analyzer.Flags.Set("requiretags", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer jsontag.Analyzer.Flags.Set("requiretags", "false")
+	analysistest.Run(t, dir, jsontag.Analyzer, "a")
+}
+
+// TestMirrors tests that struct types are compared to the struct types of
+// other packages they mirror, named by a directive or by pairing packages.
+func TestMirrors(t *testing.T) {
+	files := map[string]string{"server/server.go": `package server
+
+type Response struct {
+	ID    int      "json:\"id\""
+	Name  string   "json:\"name\""
+	Tags  []string "json:\"tags\""
+	Extra bool     "json:\"extra\""
+}
+
+type Item struct {
+	A int    "json:\"a\""
+	B string "json:\"b\""
+}
+
+type Custom struct{}
+
+func (Custom) MarshalJSON() ([]byte, error) { return nil, nil }
+`, "client/client.go": `package client
+
+import "server"
+
+var _ server.Response
+
+// Response is the response of the server.
+//
+//jsontag:mirror server.Response
+//jsontag:ignore mirror extra not used by the client
+type Response struct {
+	ID   string   "json:\"id\"" // want "json key \"id\" of Response has type string, but number in the mirrored type server.Response"
+	Name string   "json:\"name\""
+	Tags []string "json:\"tags\""
+	Old  int      "json:\"old\"" // want "json key \"old\" of Response is missing from the mirrored type server.Response"
+
+	//jsontag:ignore mirror only sent by newer servers
+	New int "json:\"new\""
+}
+
+// Item is not compared without a directive.
+type Item struct {
+	A string "json:\"a\""
+}
+
+/* want "jsontag:mirror directive names Missing, which is not an exported struct type of package server" */ //jsontag:mirror server.Missing
+type Missing struct{}
+
+/* want "jsontag:mirror directive requires a type" */ //jsontag:mirror server
+type Malformed struct{}
+
+//jsontag:mirror server.Item
+//jsontag:ignore mirror b not used by the client
+/* want "jsontag:ignore directive for check \"mirror\" does not suppress any diagnostic" */ //jsontag:ignore mirror c there is no such key
+/* want "jsontag:ignore directive for check \"mirror\" of a type requires a json key and a reason" */ //jsontag:ignore mirror a
+/* want "jsontag:ignore directive of a type only supports checks \"marshaler\" and \"mirror\"" */ //jsontag:ignore name attached to the wrong declaration
+type Partial struct {
+	A int "json:\"a\""
+}
+`, "paired/paired.go": `package paired
+
+import "server"
+
+var _ server.Item
+
+type Base struct {
+	Name int "json:\"name\""
+}
+
+type Response struct { // want "json key \"extra\" of the mirrored type server.Response is missing from Response" "json key \"id\" of the mirrored type server.Response is missing from Response" "json key \"tags\" of the mirrored type server.Response is missing from Response"
+	Base // want "json key \"name\" of Response has type number, but string in the mirrored type server.Response"
+}
+
+type Item struct {
+	A int    "json:\"a\""
+	B string "json:\"b\""
+}
+
+type Custom struct {
+	A int "json:\"a\""
+}
+
+type NotMirrored struct {
+	A int "json:\"a\""
+}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, jsontag.Analyzer, "client")
+
+	if err := jsontag.Analyzer.Flags.Set("mirrors", "paired=server"); err != nil {
+		t.Fatal(err)
+	}
+	defer jsontag.Analyzer.Flags.Set("mirrors", "")
+	analysistest.Run(t, dir, jsontag.Analyzer, "paired")
+}
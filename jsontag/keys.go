@@ -0,0 +1,196 @@
+package jsontag
+
+import (
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// jsonField is a field of a struct as it is encoded by encoding/json, possibly
+// promoted from an embedded struct.
+type jsonField struct {
+	// name is the json key of the field.
+	name string
+	// path lists the fields leading to the field, starting with the field
+	// declared in the struct itself and ending with the field.
+	path []*types.Var
+	// tagged is true if the name is set by a json struct tag.
+	tagged bool
+	// tag is the json struct tag of the field, including options.
+	tag string
+}
+
+// field returns the field itself, i.e. the last field of the path.
+func (f jsonField) field() *types.Var {
+	return f.path[len(f.path)-1]
+}
+
+// depth returns the embedding depth of the field, 0 being the struct itself.
+func (f jsonField) depth() int {
+	return len(f.path) - 1
+}
+
+// String returns the selector of the field, e.g. Embedded.Name.
+func (f jsonField) String() string {
+	names := make([]string, len(f.path))
+	for i, v := range f.path {
+		names[i] = v.Name()
+	}
+	return strings.Join(names, ".")
+}
+
+// jsonFields returns the fields of st that are encoded by encoding/json,
+// including the fields promoted from embedded structs, in breadth-first order.
+// It follows the rules of typeFields in encoding/json, but does not resolve
+// the fields that are dropped because of conflicting keys.
+func jsonFields(st *types.Struct) []jsonField {
+	type embedded struct {
+		st   *types.Struct
+		path []*types.Var
+	}
+	var fields []jsonField
+	visited := make(map[types.Type]bool)
+	next := []embedded{{st: st}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, e := range current {
+			for i := 0; i < e.st.NumFields(); i++ {
+				v := e.st.Field(i)
+				typ := v.Type()
+				if v.Anonymous() {
+					if p, ok := typ.Underlying().(*types.Pointer); ok {
+						typ = p.Elem()
+					}
+					if _, ok := typ.Underlying().(*types.Struct); !v.Exported() && !ok {
+						continue
+					}
+				} else if !v.Exported() {
+					continue
+				}
+				tag, _ := reflect.StructTag(e.st.Tag(i)).Lookup("json")
+				if tag == "-" {
+					continue
+				}
+				path := append(append([]*types.Var(nil), e.path...), v)
+				name := removeOpts(tag)
+				if !isValidTagName(name) {
+					name = ""
+				}
+				if name == "" && v.Anonymous() {
+					if est, ok := typ.Underlying().(*types.Struct); ok {
+						if !visited[typ] {
+							visited[typ] = true
+							next = append(next, embedded{st: est, path: path})
+						}
+						continue
+					}
+				}
+				f := jsonField{name: name, path: path, tagged: name != "", tag: tag}
+				if !f.tagged {
+					f.name = v.Name()
+				}
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields
+}
+
+// encodedFields returns the fields of st that are encoded by encoding/json,
+// i.e. the fields returned by jsonFields that are not dropped because of
+// conflicting keys.
+func encodedFields(st *types.Struct) []jsonField {
+	byName := make(map[string][]jsonField)
+	var names []string
+	for _, f := range jsonFields(st) {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+	var fields []jsonField
+	for _, name := range names {
+		if dominant, _ := dominantFields(byName[name]); len(dominant) == 1 {
+			fields = append(fields, dominant[0])
+		}
+	}
+	return fields
+}
+
+// checkDuplicates reports the fields of st whose json keys are dropped by
+// encoding/json, because they are shadowed by a field with the same key at a
+// lower embedding depth, or conflict with a field at the same depth.
+//
+// Fields are reported at the field of st they are declared in or promoted
+// through.
+func checkDuplicates(r *reporter, st *types.Struct) {
+	byName := make(map[string][]jsonField)
+	var names []string
+	for _, f := range jsonFields(st) {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	for _, name := range names {
+		// fields dropped within an embedded struct are reported when checking
+		// the embedded struct itself
+		var fields []jsonField
+		var tops []*types.Var
+		byTop := make(map[*types.Var][]jsonField)
+		for _, f := range byName[name] {
+			if _, ok := byTop[f.path[0]]; !ok {
+				tops = append(tops, f.path[0])
+			}
+			byTop[f.path[0]] = append(byTop[f.path[0]], f)
+		}
+		for _, top := range tops {
+			dominant, _ := dominantFields(byTop[top])
+			fields = append(fields, dominant...)
+		}
+		if len(fields) < 2 {
+			continue
+		}
+
+		dominant, shadowed := dominantFields(fields)
+		for i, f := range dominant[1:] {
+			r.reportf(checkDuplicate, f.path[0].Pos(), "json key %q of field %s conflicts with field %s, encoding/json drops both", name, f, dominant[i])
+		}
+		for _, f := range shadowed {
+			r.reportf(checkDuplicate, f.path[0].Pos(), "json key %q of field %s is shadowed by field %s", name, f, dominant[0])
+		}
+	}
+}
+
+// dominantFields splits fields with the same json key into the fields at the
+// lowest embedding depth and the fields they shadow. A single tagged field
+// shadows the untagged fields at its depth. If more than one dominant field
+// is returned, they conflict and encoding/json drops all of them.
+func dominantFields(fields []jsonField) (dominant, shadowed []jsonField) {
+	fields = append([]jsonField(nil), fields...)
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].depth() < fields[j].depth() })
+	n := 1
+	for n < len(fields) && fields[n].depth() == fields[0].depth() {
+		n++
+	}
+	dominant, shadowed = fields[:n:n], fields[n:]
+
+	var tagged []jsonField
+	for _, f := range dominant {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(dominant) > 1 && len(tagged) == 1 {
+		for _, f := range dominant {
+			if !f.tagged {
+				shadowed = append(shadowed, f)
+			}
+		}
+		dominant = tagged
+	}
+	return dominant, shadowed
+}
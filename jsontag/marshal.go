@@ -0,0 +1,171 @@
+package jsontag
+
+import (
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// unsupportedType returns the type encoding/json cannot marshal that is part of
+// t, e.g. the element type of a slice, or nil if there is none. Struct types are
+// not descended into, their fields are checked where the struct is declared.
+func unsupportedType(t types.Type) types.Type {
+	seen := make(map[types.Type]bool)
+	var unsupported func(types.Type) types.Type
+	unsupported = func(t types.Type) types.Type {
+		if seen[t] || isMarshaler(t) {
+			return nil
+		}
+		seen[t] = true
+		switch u := t.Underlying().(type) {
+		case *types.Basic:
+			if u.Info()&types.IsComplex != 0 || u.Kind() == types.UnsafePointer {
+				return t
+			}
+		case *types.Chan, *types.Signature:
+			return t
+		case *types.Pointer:
+			return unsupported(u.Elem())
+		case *types.Slice:
+			return unsupported(u.Elem())
+		case *types.Array:
+			return unsupported(u.Elem())
+		case *types.Map:
+			if !isMapKey(u.Key()) {
+				return t
+			}
+			return unsupported(u.Elem())
+		}
+		return nil
+	}
+	return unsupported(t)
+}
+
+// isMarshaler returns whether t, or a pointer to t, implements json.Marshaler
+// or encoding.TextMarshaler.
+func isMarshaler(t types.Type) bool {
+	return hasMethod(t, "MarshalJSON") || hasMethod(t, "MarshalText")
+}
+
+// isUnmarshaler returns whether t, or a pointer to t, implements
+// json.Unmarshaler or encoding.TextUnmarshaler.
+func isUnmarshaler(t types.Type) bool {
+	return hasMethod(t, "UnmarshalJSON") || hasMethod(t, "UnmarshalText")
+}
+
+// checkMarshalers reports the named type tn if it implements only one of
+// json.Marshaler and json.Unmarshaler, or of encoding.TextMarshaler and
+// encoding.TextUnmarshaler. It returns whether encoding/json uses the struct
+// tags of its fields, i.e. whether it implements neither a custom marshaler
+// nor a custom unmarshaler.
+func checkMarshalers(r *reporter, tn *types.TypeName) bool {
+	pairs := []struct {
+		prefix, marshal, unmarshal string
+	}{
+		{"json.", "MarshalJSON", "UnmarshalJSON"},
+		{"encoding.Text", "MarshalText", "UnmarshalText"},
+	}
+	for _, p := range pairs {
+		marshal, unmarshal := hasMethod(tn.Type(), p.marshal), hasMethod(tn.Type(), p.unmarshal)
+		if marshal && !unmarshal {
+			r.reportf(checkMarshaler, tn.Pos(), "%s implements %sMarshaler but not %sUnmarshaler", tn.Name(), p.prefix, p.prefix)
+		} else if unmarshal && !marshal {
+			r.reportf(checkMarshaler, tn.Pos(), "%s implements %sUnmarshaler but not %sMarshaler", tn.Name(), p.prefix, p.prefix)
+		}
+	}
+	return !isMarshaler(tn.Type()) || !isUnmarshaler(tn.Type())
+}
+
+// hasMethod returns whether t, or a pointer to t, has a method with the given
+// name.
+func hasMethod(t types.Type, name string) bool {
+	if _, ok := t.Underlying().(*types.Interface); ok {
+		return false
+	}
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// isMapKey returns whether encoding/json can marshal maps with keys of type t,
+// which are strings, integers and encoding.TextMarshalers.
+func isMapKey(t types.Type) bool {
+	if hasMethod(t, "MarshalText") {
+		return true
+	}
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&(types.IsString|types.IsInteger) != 0
+}
+
+// jsonType describes the json type values of type t are encoded as, e.g.
+// "string" or "[]number". Types with a custom encoding are opaque, and
+// described by their Go type. If quoted is true, numbers and booleans are
+// described as strings, as with the string option.
+//
+// Exported struct types are described by their name, as their keys are
+// recorded on their own. Other struct types are described by their keys, e.g.
+// "object{a number; b,omitempty []string}".
+func jsonType(t types.Type, quoted bool) string {
+	return describeType(t, quoted, make(map[*types.Named]bool))
+}
+
+// describeType is like jsonType. The named struct types currently being
+// described are marked in seen, and only described by their name when they
+// are reached again, e.g. through a pointer to the type itself.
+func describeType(t types.Type, quoted bool, seen map[*types.Named]bool) string {
+	if isMarshaler(t) {
+		return "opaque " + types.TypeString(t, packageName)
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsString != 0 || quoted:
+			return "string"
+		case u.Info()&types.IsBoolean != 0:
+			return "boolean"
+		case u.Info()&types.IsNumeric != 0:
+			return "number"
+		}
+	case *types.Pointer:
+		return describeType(u.Elem(), quoted, seen)
+	case *types.Slice:
+		if b, ok := u.Elem().Underlying().(*types.Basic); ok && b.Kind() == types.Byte && !isMarshaler(u.Elem()) {
+			return "string" // base64 encoded
+		}
+		return "[]" + describeType(u.Elem(), false, seen)
+	case *types.Array:
+		return "[]" + describeType(u.Elem(), false, seen)
+	case *types.Map:
+		return "map[string]" + describeType(u.Elem(), false, seen)
+	case *types.Struct:
+		named, ok := t.(*types.Named)
+		if ok && (named.Obj().Exported() || seen[named]) {
+			// types of other packages are not qualified, so that the
+			// types of a mirror agree with the types they mirror
+			return "object " + types.TypeString(t, func(*types.Package) string { return "" })
+		}
+		if ok {
+			seen[named] = true
+			defer delete(seen, named)
+		}
+		var keys []string
+		for _, f := range encodedFields(u) {
+			key := f.name
+			if hasOption(f.tag, "omitempty") || hasOption(f.tag, "omitzero") {
+				key += ",omitempty"
+			}
+			quoted := hasOption(f.tag, "string") && isQuotable(f.field().Type())
+			keys = append(keys, key+" "+describeType(f.field().Type(), quoted, seen))
+		}
+		sort.Strings(keys)
+		return "object{" + strings.Join(keys, "; ") + "}"
+	case *types.Interface:
+		return "any"
+	}
+	return "invalid"
+}
+
+// packageName qualifies types by the name of their package.
+func packageName(p *types.Package) string {
+	return p.Name()
+}
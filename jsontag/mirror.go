@@ -0,0 +1,187 @@
+package jsontag
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// mirrorDirective names the struct type of another package that a struct type
+// mirrors, e.g. the copy of a server response in a client package:
+// //jsontag:mirror gitlab.com/NebulousLabs/Sia/node/api.RenterGET
+const mirrorDirective = "//jsontag:mirror"
+
+// parseMirrors parses the -mirrors flag, a comma-separated list of pairs of
+// package paths, e.g. client=server, into a map from each package path to the
+// paths of the packages it is paired with.
+func parseMirrors(s string) (map[string][]string, error) {
+	pairs := make(map[string][]string)
+	for _, pair := range splitList(s) {
+		paths := strings.Split(pair, "=")
+		if len(paths) != 2 || paths[0] == "" || paths[1] == "" || paths[0] == paths[1] {
+			return nil, fmt.Errorf("invalid mirror pair %q, expected two package paths separated by =", pair)
+		}
+		pairs[paths[0]] = append(pairs[paths[0]], paths[1])
+		pairs[paths[1]] = append(pairs[paths[1]], paths[0])
+	}
+	return pairs, nil
+}
+
+// mirroredTypes returns the struct types of other packages that the named
+// struct types of the package mirror, either by a mirror directive or by
+// having the same name in a package it is paired with. Malformed directives
+// are reported.
+//
+// The mirrored types are only known if their package is a dependency of the
+// package, e.g. imported by its tests. Directives naming other packages are
+// reported when the package is analyzed along with its tests.
+func mirroredTypes(pass *analysis.Pass, pairs map[string][]string) map[*types.TypeName]*types.TypeName {
+	mirrors := make(map[*types.TypeName]*types.TypeName)
+	for _, path := range pairs[pass.Pkg.Path()] {
+		pkg := dependency(pass.Pkg, path)
+		if pkg == nil {
+			continue
+		}
+		scope := pass.Pkg.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || !isExportedStruct(tn) {
+				continue
+			}
+			if mirror, ok := pkg.Scope().Lookup(name).(*types.TypeName); ok && isExportedStruct(mirror) {
+				mirrors[tn] = mirror
+			}
+		}
+	}
+
+	for _, f := range pass.Files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				for _, cg := range typeDocs(gd, ts) {
+					for _, c := range cg.List {
+						if mirror, ok := parseMirror(pass, c); ok {
+							if tn, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName); ok {
+								mirrors[tn] = mirror
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return mirrors
+}
+
+// parseMirror parses c as a mirrorDirective, reporting it if it is malformed or
+// names an unknown type.
+func parseMirror(pass *analysis.Pass, c *ast.Comment) (*types.TypeName, bool) {
+	if c.Text != mirrorDirective && !strings.HasPrefix(c.Text, mirrorDirective+" ") {
+		return nil, false
+	}
+	arg := strings.TrimSpace(strings.TrimPrefix(c.Text, mirrorDirective))
+	dot := strings.LastIndex(arg, ".")
+	if strings.ContainsAny(arg, " \t") || dot <= 0 || dot == len(arg)-1 {
+		pass.Reportf(c.Pos(), "jsontag:mirror directive requires a type, e.g. //jsontag:mirror path/to/pkg.Type")
+		return nil, false
+	}
+	path, name := arg[:dot], arg[dot+1:]
+	pkg := dependency(pass.Pkg, path)
+	if pkg == nil {
+		if hasTestFiles(pass) {
+			pass.Reportf(c.Pos(), "jsontag:mirror directive names package %s, which is not imported by package %s or its tests", path, pass.Pkg.Path())
+		}
+		return nil, false
+	}
+	mirror, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok || !isExportedStruct(mirror) {
+		pass.Reportf(c.Pos(), "jsontag:mirror directive names %s, which is not an exported struct type of package %s", name, path)
+		return nil, false
+	}
+	return mirror, true
+}
+
+// compareMirror compares the json encoding of the struct type tn to the type it
+// mirrors, reporting keys that are missing from either type and keys whose
+// types differ. Keys missing from tn are suppressed by a directive of the type,
+// e.g. //jsontag:ignore mirror key the reason.
+func compareMirror(r *reporter, tn, mirror *types.TypeName) {
+	if isMarshaler(mirror.Type()) {
+		return // the encoding of the mirrored type is unknown
+	}
+	keys, fields := encodedKeys(tn.Type().Underlying().(*types.Struct))
+	mirrorKeys, _ := encodedKeys(mirror.Type().Underlying().(*types.Struct))
+	mirrorName := types.TypeString(mirror.Type(), packageName)
+
+	for _, key := range sortedKeys(keys) {
+		pos := fieldPos(r.pass, fields[key], tn.Pos())
+		other, ok := mirrorKeys[key]
+		if !ok {
+			r.reportf(checkMirror, pos, "json key %q of %s is missing from the mirrored type %s", key, tn.Name(), mirrorName)
+		} else if other.Type != keys[key].Type {
+			r.reportf(checkMirror, pos, "json key %q of %s has type %s, but %s in the mirrored type %s", key, tn.Name(), keys[key].Type, other.Type, mirrorName)
+		}
+	}
+	for _, key := range sortedKeys(mirrorKeys) {
+		if _, ok := keys[key]; !ok {
+			r.reportKeyf(checkMirror, key, tn.Pos(), "json key %q of the mirrored type %s is missing from %s", key, mirrorName, tn.Name())
+		}
+	}
+}
+
+// typeDocs returns the comments of the type declared by ts, which is one of the
+// specs of gd. The doc comment of gd belongs to the type if it is the only
+// spec.
+func typeDocs(gd *ast.GenDecl, ts *ast.TypeSpec) []*ast.CommentGroup {
+	var docs []*ast.CommentGroup
+	for _, cg := range []*ast.CommentGroup{ts.Doc, ts.Comment} {
+		if cg != nil {
+			docs = append(docs, cg)
+		}
+	}
+	if len(gd.Specs) == 1 && gd.Doc != nil {
+		docs = append(docs, gd.Doc)
+	}
+	return docs
+}
+
+// dependency returns the package with the given path among the direct and
+// indirect imports of pkg, or nil if there is none.
+func dependency(pkg *types.Package, path string) *types.Package {
+	seen := make(map[*types.Package]bool)
+	var find func(pkg *types.Package) *types.Package
+	find = func(pkg *types.Package) *types.Package {
+		for _, imp := range pkg.Imports() {
+			if seen[imp] {
+				continue
+			}
+			seen[imp] = true
+			if imp.Path() == path {
+				return imp
+			}
+			if dep := find(imp); dep != nil {
+				return dep
+			}
+		}
+		return nil
+	}
+	return find(pkg)
+}
+
+// isExportedStruct returns whether tn is an exported struct type, which is not
+// an alias.
+func isExportedStruct(tn *types.TypeName) bool {
+	if !tn.Exported() || tn.IsAlias() {
+		return false
+	}
+	_, ok := tn.Type().Underlying().(*types.Struct)
+	return ok
+}
@@ -0,0 +1,219 @@
+package jsontag
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+	"unicode"
+)
+
+// namingDirective selects the naming convention of a package, overriding the
+// -naming flag, e.g. //jsontag:naming snake
+const namingDirective = "//jsontag:naming "
+
+// naming is a naming convention for json struct tags.
+type naming string
+
+const (
+	// namingLowercase is the field name in lowercase, e.g. UserID -> userid.
+	namingLowercase naming = "lowercase"
+	// namingCamel is the field name in camelCase, e.g. UserID -> userId.
+	namingCamel naming = "camel"
+	// namingSnake is the field name in snake_case, e.g. UserID -> user_id.
+	namingSnake naming = "snake"
+	// namingKebab is the field name in kebab-case, e.g. UserID -> user-id.
+	namingKebab naming = "kebab"
+)
+
+// commonInitialisms are the initialisms that are treated as a single word,
+// even when followed by a plural s, e.g. IDs or URLs.
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true,
+	"DNS": true, "EOF": true, "GUID": true, "HTML": true, "HTTP": true,
+	"HTTPS": true, "ID": true, "IP": true, "JSON": true, "RAM": true,
+	"RPC": true, "SQL": true, "SSH": true, "TCP": true, "TLS": true,
+	"TTL": true, "UDP": true, "UI": true, "UID": true, "URI": true,
+	"URL": true, "UUID": true, "XML": true,
+}
+
+// commonMixedWords are the words mixing uppercase and lowercase letters that are
+// treated as a single word, e.g. OAuthToken -> OAuth, Token. Initialisms
+// followed by a version, e.g. IPv4, are single words as well.
+var commonMixedWords = []string{"OAuth"}
+
+// parseNaming returns the naming convention with the given name.
+func parseNaming(s string) (naming, error) {
+	switch n := naming(s); n {
+	case namingLowercase, namingCamel, namingSnake, namingKebab:
+		return n, nil
+	}
+	return "", fmt.Errorf("unknown naming convention %q, expected one of lowercase, camel, snake or kebab", s)
+}
+
+// packageNaming returns the naming convention selected by a naming directive
+// in one of the files, or def if there is none.
+func packageNaming(files []*ast.File, def naming) (naming, error) {
+	for _, f := range files {
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				if !strings.HasPrefix(c.Text, namingDirective) {
+					continue
+				}
+				return parseNaming(strings.TrimSpace(strings.TrimPrefix(c.Text, namingDirective)))
+			}
+		}
+	}
+	return def, nil
+}
+
+// tagName returns the json struct tag name expected for the given Go struct
+// field name.
+func (n naming) tagName(field string) string {
+	return n.join(splitWords(field))
+}
+
+// join joins the words of a name following the naming convention.
+func (n naming) join(words []string) string {
+	switch n {
+	case namingCamel:
+		words = append([]string(nil), words...)
+		for i, w := range words {
+			if i == 0 {
+				words[i] = strings.ToLower(w)
+			} else {
+				words[i] = strings.ToUpper(w[:1]) + strings.ToLower(w[1:])
+			}
+		}
+		return strings.Join(words, "")
+	case namingSnake:
+		return strings.ToLower(strings.Join(words, "_"))
+	case namingKebab:
+		return strings.ToLower(strings.Join(words, "-"))
+	}
+	return strings.ToLower(strings.Join(words, ""))
+}
+
+// convention is a naming convention, along with the words that are ignored
+// at the start of field and tag names, e.g. static in StaticFoo, and the words
+// that are ignored at their end, e.g. deprecated in FooDeprecated.
+type convention struct {
+	naming   naming
+	prefixes []string
+	suffixes []string
+}
+
+// tagName returns the json struct tag name expected for the given Go struct
+// field name, without the ignored prefixes and suffixes.
+func (c convention) tagName(field string) string {
+	words := splitWords(field)
+	for len(words) > 1 && hasWord(c.prefixes, words[0]) {
+		words = words[1:]
+	}
+	for len(words) > 1 && hasWord(c.suffixes, words[len(words)-1]) {
+		words = words[:len(words)-1]
+	}
+	return c.naming.join(words)
+}
+
+// trimTag returns the tag name without the ignored prefixes and suffixes, e.g.
+// foo for staticFoo or foo_deprecated. Tag names without word boundaries, e.g.
+// staticfoo, are returned as they are.
+func (c convention) trimTag(tag string) string {
+	lower := tag != "" && unicode.IsLower([]rune(tag)[0])
+	for {
+		words := splitWords(strings.Replace(tag, "-", "_", -1))
+		if len(words) < 2 {
+			return tag
+		}
+		first, last := words[0], words[len(words)-1]
+		switch {
+		case hasWord(c.prefixes, first) && strings.HasPrefix(tag, first):
+			tag = strings.TrimLeft(tag[len(first):], "_-")
+			if lower {
+				r := []rune(tag)
+				tag = string(unicode.ToLower(r[0])) + string(r[1:])
+			}
+		case hasWord(c.suffixes, last) && strings.HasSuffix(tag, last):
+			tag = strings.TrimRight(tag[:len(tag)-len(last)], "_-")
+		default:
+			return tag
+		}
+	}
+}
+
+// hasWord returns whether word is one of words, ignoring case.
+func hasWord(words []string, word string) bool {
+	for _, w := range words {
+		if strings.EqualFold(word, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitWords splits a Go identifier into its words, keeping initialisms
+// together, e.g. HTTPServerURL -> HTTP, Server, URL and UserIDs -> User, IDs.
+// Underscores separate words as well.
+func splitWords(name string) []string {
+	var words []string
+	for _, part := range strings.Split(name, "_") {
+		r := []rune(part)
+		start := 0
+		for i := 1; i < len(r); i++ {
+			if i < start+mixedWordLen(r[start:]) || !unicode.IsUpper(r[i]) {
+				continue
+			}
+			// a lowercase letter or digit followed by an uppercase letter
+			// starts a new word, e.g. userID
+			boundary := !unicode.IsUpper(r[i-1])
+			// the last uppercase letter of an initialism followed by a
+			// lowercase letter starts a new word, e.g. HTTPServer, unless it is
+			// the plural of a common initialism, e.g. IDs
+			if unicode.IsUpper(r[i-1]) && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+				plural := r[i+1] == 's' && (i+2 == len(r) || unicode.IsUpper(r[i+2]))
+				boundary = !plural || !commonInitialisms[string(r[start:i+1])]
+			}
+			if boundary {
+				words = append(words, string(r[start:i]))
+				start = i
+			}
+		}
+		if start < len(r) {
+			words = append(words, string(r[start:]))
+		}
+	}
+	return words
+}
+
+// mixedWordLen returns the length of the word mixing uppercase and lowercase
+// letters that r starts with, i.e. one of commonMixedWords or a common
+// initialism followed by a lowercase letter and digits, e.g. IPv4. It returns 0
+// if r starts with neither.
+func mixedWordLen(r []rune) int {
+	// a known word ends where the next word starts, e.g. OAuthToken but not
+	// OAuthorize
+	end := func(n int) int {
+		if n < len(r) && unicode.IsLower(r[n]) {
+			return 0
+		}
+		return n
+	}
+	for _, w := range commonMixedWords {
+		if strings.HasPrefix(string(r), w) {
+			return end(len([]rune(w)))
+		}
+	}
+
+	n := 0
+	for n < len(r) && unicode.IsUpper(r[n]) {
+		n++
+	}
+	if !commonInitialisms[string(r[:n])] || n+2 > len(r) || !unicode.IsLower(r[n]) || !unicode.IsDigit(r[n+1]) {
+		return 0
+	}
+	n += 2
+	for n < len(r) && unicode.IsDigit(r[n]) {
+		n++
+	}
+	return end(n)
+}
@@ -0,0 +1,102 @@
+package jsontag
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSplitWords probes the splitWords function
+func TestSplitWords(t *testing.T) {
+	var tests = []struct {
+		name  string
+		words []string
+	}{
+		{"A", []string{"A"}},
+		{"foo", []string{"foo"}},
+		{"FooBar", []string{"Foo", "Bar"}},
+		{"UserID", []string{"User", "ID"}},
+		{"IPAddress", []string{"IP", "Address"}},
+		{"HTTPServerURL", []string{"HTTP", "Server", "URL"}},
+		{"UserIDs", []string{"User", "IDs"}},
+		{"URLsByID", []string{"URLs", "By", "ID"}},
+		{"Foo2Bar", []string{"Foo2", "Bar"}},
+		{"foo_bar", []string{"foo", "bar"}},
+		{"staticFoo", []string{"static", "Foo"}},
+		{"IPv4", []string{"IPv4"}},
+		{"RemoteIPv6Address", []string{"Remote", "IPv6", "Address"}},
+		{"OAuth", []string{"OAuth"}},
+		{"UserOAuthToken", []string{"User", "OAuth", "Token"}},
+		{"OAuthorize", []string{"O", "Authorize"}},
+	}
+
+	for _, test := range tests {
+		if words := splitWords(test.name); !reflect.DeepEqual(words, test.words) {
+			t.Errorf("splitWords(%q) = %q; expected %q", test.name, words, test.words)
+		}
+	}
+}
+
+// TestTagName probes the tagName method of the naming conventions, ignoring
+// the word static
+func TestTagName(t *testing.T) {
+	var tests = []struct {
+		field                          string
+		lowercase, camel, snake, kebab string
+	}{
+		{"A", "a", "a", "a", "a"},
+		{"UserID", "userid", "userId", "user_id", "user-id"},
+		{"IPAddress", "ipaddress", "ipAddress", "ip_address", "ip-address"},
+		{"HTTPServerURL", "httpserverurl", "httpServerUrl", "http_server_url", "http-server-url"},
+		{"UserIDs", "userids", "userIds", "user_ids", "user-ids"},
+		{"StaticH", "h", "h", "h", "h"},
+		{"StaticFooBar", "foobar", "fooBar", "foo_bar", "foo-bar"},
+		{"HostStatic", "hoststatic", "hostStatic", "host_static", "host-static"},
+		{"OAuthToken", "oauthtoken", "oauthToken", "oauth_token", "oauth-token"},
+		{"IPv4Address", "ipv4address", "ipv4Address", "ipv4_address", "ipv4-address"},
+	}
+
+	for _, test := range tests {
+		for n, expected := range map[naming]string{
+			namingLowercase: test.lowercase,
+			namingCamel:     test.camel,
+			namingSnake:     test.snake,
+			namingKebab:     test.kebab,
+		} {
+			c := convention{naming: n, prefixes: []string{"static"}}
+			if name := c.tagName(test.field); name != expected {
+				t.Errorf("%s.tagName(%q) = %q; expected %q", n, test.field, name, expected)
+			}
+		}
+	}
+}
+
+// TestTrimTag probes the trimTag method of convention
+func TestTrimTag(t *testing.T) {
+	c := convention{
+		naming:   namingCamel,
+		prefixes: []string{"static"},
+		suffixes: []string{"deprecated"},
+	}
+	var tests = []struct {
+		tag, trimmed string
+	}{
+		{"foo", "foo"},
+		{"staticFoo", "foo"},
+		{"StaticFoo", "Foo"},
+		{"fooDeprecated", "foo"},
+		{"staticFooDeprecated", "foo"},
+		{"static_foo", "foo"},
+		{"foo-deprecated", "foo"},
+		{"staticfoo", "staticfoo"},
+		{"static", "static"},
+		{"staticDeprecated", "deprecated"},
+		{"fooStatic", "fooStatic"},
+		{"deprecatedFoo", "deprecatedFoo"},
+	}
+
+	for _, test := range tests {
+		if trimmed := c.trimTag(test.tag); trimmed != test.trimmed {
+			t.Errorf("trimTag(%q) = %q; expected %q", test.tag, trimmed, test.trimmed)
+		}
+	}
+}
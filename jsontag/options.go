@@ -0,0 +1,137 @@
+package jsontag
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// knownOptions are the options of json struct tags understood by
+// encoding/json, along with siamismatch, which disables the name check.
+var knownOptions = []string{"omitempty", "omitzero", "string", "siamismatch"}
+
+// checkOptions reports unknown, repeated and misapplied options of the json
+// struct tag of field, declared by decl. Options that are likely typos of a
+// known option are fixed by the suggested fixes.
+func checkOptions(r *reporter, field *types.Var, decl *ast.Field, tag string) {
+	opts := strings.Split(tag, ",")[1:]
+	seen := make(map[string]bool)
+	for _, opt := range opts {
+		if opt == "" {
+			continue
+		}
+		if seen[opt] {
+			r.reportf(checkOption, field.Pos(), "json struct tag option %q is repeated", opt)
+			continue
+		}
+		seen[opt] = true
+
+		if !isKnownOption(opt) {
+			if known, ok := closestOption(opt); ok {
+				r.report(checkOption, analysis.Diagnostic{
+					Pos:            field.Pos(),
+					Message:        fmt.Sprintf("unknown json struct tag option %q, did you mean %q?", opt, known),
+					SuggestedFixes: optionFix(decl, "json", opt, known),
+				})
+			} else {
+				r.reportf(checkOption, field.Pos(), "unknown json struct tag option %q", opt)
+			}
+			continue
+		}
+		if opt == "string" && !isQuotable(field.Type()) {
+			r.reportf(checkOption, field.Pos(), "json struct tag option \"string\" on field %s of type %s, which only applies to strings, numbers and booleans", field.Name(), types.TypeString(field.Type(), types.RelativeTo(r.pass.Pkg)))
+		}
+	}
+}
+
+// hasOption returns whether the json struct tag has the option opt.
+func hasOption(tag, opt string) bool {
+	for _, o := range strings.Split(tag, ",")[1:] {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownOption returns whether opt is one of the knownOptions.
+func isKnownOption(opt string) bool {
+	for _, known := range knownOptions {
+		if opt == known {
+			return true
+		}
+	}
+	return false
+}
+
+// closestOption returns the known option that opt is most likely a typo of,
+// i.e. the closest known option within an edit distance of 2.
+func closestOption(opt string) (string, bool) {
+	best, bestDist := "", 3
+	for _, known := range knownOptions {
+		if d := editDistance(strings.ToLower(opt), known); d < bestDist {
+			best, bestDist = known, d
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance returns the Damerau-Levenshtein distance between a and b,
+// counting the transposition of two adjacent characters as a single edit.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j-1] + cost
+			if d[i-1][j]+1 < d[i][j] {
+				d[i][j] = d[i-1][j] + 1
+			}
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// isQuotable returns whether the string option applies to fields of type t,
+// which are strings, numbers and booleans, or unnamed pointers to them.
+func isQuotable(t types.Type) bool {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&(types.IsString|types.IsInteger|types.IsFloat|types.IsBoolean) != 0
+}
+
+// isValidTagName returns whether encoding/json accepts name as the key of a
+// field. Keys containing other characters are ignored, and the field name is
+// used instead.
+func isValidTagName(name string) bool {
+	for _, c := range name {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return false
+		}
+	}
+	return true
+}
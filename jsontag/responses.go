@@ -0,0 +1,168 @@
+package jsontag
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// untaggedFact is exported for the fields without a json struct tag whose
+// untagged check is suppressed by a directive, so that packages encoding them
+// do not report them either.
+type untaggedFact struct {
+	Reason string
+}
+
+// AFact implements analysis.Fact.
+func (*untaggedFact) AFact() {}
+
+// String implements fmt.Stringer.
+func (f *untaggedFact) String() string {
+	return "ignores untagged: " + f.Reason
+}
+
+// responseFields finds the values passed to the JSON response helpers, and
+// returns the exported fields without a json struct tag that are encoded as
+// part of them, mapped to the name of the helper. Fields declared in other
+// packages are reported right away at the call of the helper, as they cannot
+// be reported where they are declared, unless they have an untaggedFact.
+func responseFields(pass *analysis.Pass, inspect *inspector.Inspector, helpers []string) map[*types.Var]string {
+	untagged := make(map[*types.Var]string)
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		helper, ok := helperName(pass, call, helpers)
+		if !ok || len(call.Args) == 0 {
+			return
+		}
+		t := pass.TypesInfo.TypeOf(call.Args[len(call.Args)-1])
+		if t == nil {
+			return
+		}
+		reported := make(map[*types.Var]bool)
+		walkUntagged(t, func(field *types.Var, owner string) {
+			// the fields of instantiated generic types whose type depends on
+			// a type parameter are distinct from the declared fields
+			field = field.Origin()
+			if field.Pkg() == pass.Pkg {
+				if _, ok := untagged[field]; !ok {
+					untagged[field] = helper
+				}
+			} else if !reported[field] && !pass.ImportObjectFact(field, new(untaggedFact)) {
+				reported[field] = true
+				pass.Reportf(call.Pos(), "field %s of %s is encoded by %s without a json struct tag", field.Name(), owner, helper)
+			}
+		})
+	})
+	return untagged
+}
+
+// helperName returns the name of the function called by call, if it is one of
+// the JSON response helpers.
+func helperName(pass *analysis.Pass, call *ast.CallExpr, helpers []string) (string, bool) {
+	var id *ast.Ident
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return "", false
+	}
+	if _, ok := pass.TypesInfo.Uses[id].(*types.Func); !ok {
+		return "", false
+	}
+	for _, h := range helpers {
+		if id.Name == h {
+			return h, true
+		}
+	}
+	return "", false
+}
+
+// walkUntagged calls untagged for each exported field without a json struct
+// tag that is encoded as part of values of type t, along with the name of the
+// type declaring it. Types with custom marshalers are not descended into.
+func walkUntagged(t types.Type, untagged func(field *types.Var, owner string)) {
+	seen := make(map[types.Type]bool)
+	var walk func(t types.Type)
+	walk = func(t types.Type) {
+		if seen[t] || isMarshaler(t) {
+			return
+		}
+		seen[t] = true
+		switch u := t.Underlying().(type) {
+		case *types.Pointer:
+			walk(u.Elem())
+		case *types.Slice:
+			walk(u.Elem())
+		case *types.Array:
+			walk(u.Elem())
+		case *types.Map:
+			walk(u.Elem())
+		case *types.Struct:
+			owner := types.TypeString(t, packageName)
+			for i := 0; i < u.NumFields(); i++ {
+				field := u.Field(i)
+				tag, ok := reflect.StructTag(u.Tag(i)).Lookup("json")
+				if tag == "-" {
+					continue
+				}
+				if !ok && field.Exported() && !(field.Anonymous() && isStruct(field.Type())) {
+					untagged(field, owner)
+				}
+				if field.Exported() || field.Anonymous() {
+					walk(field.Type())
+				}
+			}
+		}
+	}
+	walk(t)
+}
+
+// isStruct returns whether t is a struct, or a pointer to a struct.
+func isStruct(t types.Type) bool {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	_, ok := t.Underlying().(*types.Struct)
+	return ok
+}
+
+// addTagFix returns a suggested fix that adds the given key to the struct tag
+// of field, adding a struct tag if there is none. Declarations of multiple
+// fields are not fixed, as they share their struct tag.
+func addTagFix(field *ast.Field, key, name string) []analysis.SuggestedFix {
+	if len(field.Names) > 1 {
+		return nil
+	}
+	message := fmt.Sprintf("Add %s struct tag %q", key, name)
+	if field.Tag != nil {
+		return tagFix(field, message, func(raw string) (string, bool) {
+			return strings.TrimSpace(fmt.Sprintf("%s:%q %s", key, name, raw)), true
+		})
+	}
+	return []analysis.SuggestedFix{{
+		Message: message,
+		TextEdits: []analysis.TextEdit{{
+			Pos:     field.Type.End(),
+			End:     field.Type.End(),
+			NewText: []byte(fmt.Sprintf(" `%s:%q`", key, name)),
+		}},
+	}}
+}
+
+// splitList splits a comma-separated flag value, omitting empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
@@ -0,0 +1,199 @@
+package jsontag
+
+import (
+	"go/types"
+	"strings"
+)
+
+// Schema is a JSON Schema, restricted to the subset that is shared with the
+// component schemas of OpenAPI 3, along with the nullable keyword of OpenAPI
+// 3.0.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+
+	// Opaque marks types with a custom MarshalJSON method, whose encoding is
+	// unknown.
+	Opaque bool `json:"x-opaque,omitempty"`
+}
+
+// A Generator generates the schemas of Go types, following the rules of
+// encoding/json. The schemas of named struct types are collected in Defs,
+// and referenced by RefPrefix followed by their name.
+type Generator struct {
+	// RefPrefix is the prefix of references to definitions, e.g.
+	// "#/$defs/" for JSON Schema or "#/components/schemas/" for OpenAPI.
+	RefPrefix string
+	// Defs are the schemas of the named struct types, by name. Types that
+	// are not declared in Pkg are qualified by their package name, or by
+	// their import path if another package of that name was qualified
+	// first, e.g. api.Response and gitlab.com.NebulousLabs.Sia.node.api.Response.
+	Defs map[string]*Schema
+	// Pkg is the package the schemas are generated for, if any.
+	Pkg *types.Package
+	// OpenAPI marks the schemas of pointers with the nullable keyword of
+	// OpenAPI 3.0, instead of allowing the null type of JSON Schema.
+	OpenAPI bool
+
+	// qualifiers holds the qualifier of every package qualified so far, and
+	// qualified the package of every qualifier, see qualifier.
+	qualifiers map[*types.Package]string
+	qualified  map[string]*types.Package
+}
+
+// NewGenerator returns a Generator for the types of pkg. If pkg is nil, the
+// names of all types are qualified by their package name.
+func NewGenerator(pkg *types.Package, refPrefix string) *Generator {
+	return &Generator{
+		RefPrefix: refPrefix,
+		Defs:      make(map[string]*Schema),
+		Pkg:       pkg,
+	}
+}
+
+// AddPackage adds the definitions of the exported struct types of pkg, or only
+// the ones with the given names, if any. It returns the names that are not
+// exported struct types of pkg.
+func (g *Generator) AddPackage(pkg *types.Package, names ...string) (missing []string) {
+	scope := pkg.Scope()
+	all := len(names) == 0
+	if all {
+		names = scope.Names()
+	}
+	for _, name := range names {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if ok && tn.Exported() && !tn.IsAlias() {
+			if _, ok := tn.Type().Underlying().(*types.Struct); ok {
+				g.Schema(tn.Type())
+				continue
+			}
+		}
+		if !all {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Schema returns the schema of values of type t, adding the definitions of the
+// named struct types it refers to.
+func (g *Generator) Schema(t types.Type) *Schema {
+	return g.schema(t, false)
+}
+
+// schema returns the schema of values of type t. If quoted is true, numbers and
+// booleans are encoded as strings, as with the string option.
+func (g *Generator) schema(t types.Type, quoted bool) *Schema {
+	switch {
+	case hasMethod(t, "MarshalJSON"):
+		return &Schema{
+			Description: "encoded by " + types.TypeString(t, g.qualifier) + ".MarshalJSON",
+			Opaque:      true,
+		}
+	case hasMethod(t, "MarshalText"):
+		return &Schema{Type: "string"}
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsString != 0 || quoted:
+			return &Schema{Type: "string"}
+		case u.Info()&types.IsBoolean != 0:
+			return &Schema{Type: "boolean"}
+		case u.Info()&types.IsInteger != 0:
+			return &Schema{Type: "integer"}
+		case u.Info()&types.IsFloat != 0:
+			return &Schema{Type: "number"}
+		}
+	case *types.Pointer:
+		return g.nullable(g.schema(u.Elem(), quoted))
+	case *types.Slice:
+		if b, ok := u.Elem().Underlying().(*types.Basic); ok && b.Kind() == types.Byte && !isMarshaler(u.Elem()) {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(u.Elem(), false)}
+	case *types.Array:
+		return &Schema{Type: "array", Items: g.schema(u.Elem(), false)}
+	case *types.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(u.Elem(), false)}
+	case *types.Interface:
+		return &Schema{}
+	case *types.Struct:
+		named, ok := t.(*types.Named)
+		if !ok {
+			return g.structSchema(u)
+		}
+		name := types.TypeString(named, g.qualifier)
+		if _, ok := g.Defs[name]; !ok {
+			g.Defs[name] = nil // break cycles
+			g.Defs[name] = g.structSchema(u)
+		}
+		return &Schema{Ref: g.RefPrefix + name}
+	}
+	return &Schema{Description: "unsupported type " + types.TypeString(t, g.qualifier)}
+}
+
+// nullable returns a schema allowing null, the encoding of nil pointers, in
+// addition to the values of s.
+func (g *Generator) nullable(s *Schema) *Schema {
+	if !g.OpenAPI {
+		return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+	}
+	if s.Ref != "" {
+		// siblings of $ref are ignored by OpenAPI 3.0
+		return &Schema{AllOf: []*Schema{s}, Nullable: true}
+	}
+	s.Nullable = true
+	return s
+}
+
+// structSchema returns the schema of the struct type st. Keys that are not
+// omitted when empty are required.
+func (g *Generator) structSchema(st *types.Struct) *Schema {
+	s := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+	for _, f := range encodedFields(st) {
+		quoted := hasOption(f.tag, "string") && isQuotable(f.field().Type())
+		s.Properties[f.name] = g.schema(f.field().Type(), quoted)
+		if !hasOption(f.tag, "omitempty") && !hasOption(f.tag, "omitzero") {
+			s.Required = append(s.Required, f.name)
+		}
+	}
+	return s
+}
+
+// qualifier qualifies the types of other packages by their package name. A
+// package whose name is already used by another package is qualified by its
+// import path instead, with slashes replaced by dots, so that the types of
+// both packages have their own definition.
+func (g *Generator) qualifier(p *types.Package) string {
+	if p == g.Pkg {
+		return ""
+	}
+	if q, ok := g.qualifiers[p]; ok {
+		return q
+	}
+	if g.qualifiers == nil {
+		g.qualifiers = make(map[*types.Package]string)
+		g.qualified = make(map[string]*types.Package)
+	}
+	q := p.Name()
+	if _, ok := g.qualified[q]; ok {
+		q = strings.Replace(p.Path(), "/", ".", -1)
+	}
+	g.qualifiers[p] = q
+	g.qualified[q] = p
+	return q
+}
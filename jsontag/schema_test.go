@@ -0,0 +1,178 @@
+package jsontag
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+// TestSchema tests the schemas generated for the struct types of a package.
+func TestSchema(t *testing.T) {
+	src := `package a
+
+type Base struct {
+	ID int "json:\"id\""
+}
+
+type Item struct {
+	Base
+	Name    string            "json:\"name\""
+	Tags    []string          "json:\"tags,omitempty\""
+	Data    []byte            "json:\"data\""
+	Price   float64           "json:\"price,string\""
+	Meta    map[string]*bool  "json:\"meta\""
+	Next    *Item             "json:\"next,omitempty\""
+	Custom  Custom            "json:\"custom\""
+	Text    Text              "json:\"text\""
+	Skipped int               "json:\"-\""
+	hidden  int
+}
+
+type Custom struct{}
+
+func (Custom) MarshalJSON() ([]byte, error) { return nil, nil }
+
+type Text int
+
+func (*Text) MarshalText() ([]byte, error) { return nil, nil }
+
+type notExported struct{}
+
+type NotStruct int
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "a.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("a", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		openAPI  bool
+		expected string
+	}{
+		{false, `{` +
+			`"Item":{"type":"object","properties":{` +
+			`"custom":{"description":"encoded by Custom.MarshalJSON","x-opaque":true},` +
+			`"data":{"type":"string","format":"byte"},` +
+			`"id":{"type":"integer"},` +
+			`"meta":{"type":"object","additionalProperties":{"anyOf":[{"type":"boolean"},{"type":"null"}]}},` +
+			`"name":{"type":"string"},` +
+			`"next":{"anyOf":[{"$ref":"#/$defs/Item"},{"type":"null"}]},` +
+			`"price":{"type":"string"},` +
+			`"tags":{"type":"array","items":{"type":"string"}},` +
+			`"text":{"type":"string"}},` +
+			`"required":["name","data","price","meta","custom","text","id"]}}`},
+		{true, `{` +
+			`"Item":{"type":"object","properties":{` +
+			`"custom":{"description":"encoded by Custom.MarshalJSON","x-opaque":true},` +
+			`"data":{"type":"string","format":"byte"},` +
+			`"id":{"type":"integer"},` +
+			`"meta":{"type":"object","additionalProperties":{"type":"boolean","nullable":true}},` +
+			`"name":{"type":"string"},` +
+			`"next":{"allOf":[{"$ref":"#/components/schemas/Item"}],"nullable":true},` +
+			`"price":{"type":"string"},` +
+			`"tags":{"type":"array","items":{"type":"string"}},` +
+			`"text":{"type":"string"}},` +
+			`"required":["name","data","price","meta","custom","text","id"]}}`},
+	}
+
+	for _, test := range tests {
+		refPrefix := "#/$defs/"
+		if test.openAPI {
+			refPrefix = "#/components/schemas/"
+		}
+		g := NewGenerator(pkg, refPrefix)
+		g.OpenAPI = test.openAPI
+		if missing := g.AddPackage(pkg, "Item", "notExported", "NotStruct"); len(missing) != 2 {
+			t.Fatalf("expected notExported and NotStruct to be missing, got %v", missing)
+		}
+		b, err := json.Marshal(g.Defs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.expected {
+			t.Errorf("unexpected schemas with openAPI %v:\n%s\nexpected:\n%s", test.openAPI, b, test.expected)
+		}
+	}
+}
+
+// TestSchemaPackageNames tests that the struct types of different packages with
+// the same name have their own definitions.
+func TestSchemaPackageNames(t *testing.T) {
+	srcs := []struct {
+		path, src string
+	}{
+		{"x/api", `package api
+
+type Response struct {
+	A int "json:\"a\""
+}
+`},
+		{"y/api", `package api
+
+type Response struct {
+	B int "json:\"b\""
+}
+`},
+		{"a", `package a
+
+import (
+	x "x/api"
+	y "y/api"
+)
+
+type Both struct {
+	X x.Response "json:\"x\""
+	Y y.Response "json:\"y\""
+}
+`},
+	}
+	fset := token.NewFileSet()
+	pkgs := make(map[string]*types.Package)
+	conf := types.Config{Importer: importerFunc(func(path string) (*types.Package, error) {
+		return pkgs[path], nil
+	})}
+	for _, src := range srcs {
+		f, err := parser.ParseFile(fset, src.path+".go", src.src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := conf.Check(src.path, fset, []*ast.File{f}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkgs[src.path] = pkg
+	}
+
+	g := NewGenerator(pkgs["a"], "#/$defs/")
+	g.AddPackage(pkgs["a"])
+	b, err := json.Marshal(g.Defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{` +
+		`"Both":{"type":"object","properties":{` +
+		`"x":{"$ref":"#/$defs/api.Response"},` +
+		`"y":{"$ref":"#/$defs/y.api.Response"}},` +
+		`"required":["x","y"]},` +
+		`"api.Response":{"type":"object","properties":{"a":{"type":"integer"}},"required":["a"]},` +
+		`"y.api.Response":{"type":"object","properties":{"b":{"type":"integer"}},"required":["b"]}}`
+	if string(b) != expected {
+		t.Errorf("unexpected schemas:\n%s\nexpected:\n%s", b, expected)
+	}
+}
+
+// importerFunc is an adapter for the types.Importer interface.
+type importerFunc func(path string) (*types.Package, error)
+
+// Import implements types.Importer by calling f.
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
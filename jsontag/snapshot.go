@@ -0,0 +1,183 @@
+package jsontag
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// snapshot records the json encoding of the exported struct types of a
+// package, by type name.
+type snapshot map[string]map[string]snapshotKey
+
+// snapshotKey records the json encoding of a single key of a struct type.
+type snapshotKey struct {
+	Type      string `json:"type"`
+	OmitEmpty bool   `json:"omitempty"`
+}
+
+// Snapshot returns the contents of the API snapshot file of pkg, whose files
+// are in fset, which is checked by the -snapshot flag of the analyzer. Types
+// declared in test files are omitted.
+func Snapshot(fset *token.FileSet, pkg *types.Package) ([]byte, error) {
+	snap, _ := takeSnapshot(fset, pkg)
+	b, err := json.MarshalIndent(snap, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// takeSnapshot returns the snapshot of the exported struct types of pkg, along
+// with the declaring fields of their keys. Types declared in test files are
+// omitted.
+func takeSnapshot(fset *token.FileSet, pkg *types.Package) (snapshot, map[string]map[string]jsonField) {
+	snap := make(snapshot)
+	fields := make(map[string]map[string]jsonField)
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || !tn.Exported() || tn.IsAlias() || isTestFile(fset, tn.Pos()) {
+			continue
+		}
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok || isMarshaler(tn.Type()) {
+			continue
+		}
+		snap[name], fields[name] = encodedKeys(st)
+	}
+	return snap, fields
+}
+
+// encodedKeys returns the json encoding of the keys of the struct type st,
+// along with their declaring fields.
+func encodedKeys(st *types.Struct) (map[string]snapshotKey, map[string]jsonField) {
+	keys := make(map[string]snapshotKey)
+	fields := make(map[string]jsonField)
+	for _, f := range encodedFields(st) {
+		quoted := hasOption(f.tag, "string") && isQuotable(f.field().Type())
+		keys[f.name] = snapshotKey{
+			Type:      jsonType(f.field().Type(), quoted),
+			OmitEmpty: hasOption(f.tag, "omitempty") || hasOption(f.tag, "omitzero"),
+		}
+		fields[f.name] = f
+	}
+	return keys, fields
+}
+
+// checkSnapshot compares the json encoding of the exported struct types of the
+// package to the snapshot file in the package directory, reporting changes
+// that break API compatibility. Packages without a snapshot file are skipped,
+// as are the packages of the standard library and of versioned modules, which
+// are only analyzed as dependencies. The snapshot files are written by the
+// apisnapshot command.
+func checkSnapshot(pass *analysis.Pass) error {
+	if len(pass.Files) == 0 || strings.HasSuffix(pass.Pkg.Path(), "_test") {
+		return nil // external test packages share the directory of the package
+	}
+	dir := filepath.Dir(pass.Fset.File(pass.Files[0].Pos()).Name())
+	if isDependency(pass, dir) {
+		return nil
+	}
+	path := filepath.Join(dir, flagSnapshot)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var old snapshot
+	if err := json.Unmarshal(b, &old); err != nil {
+		return fmt.Errorf("could not parse API snapshot %s: %v", path, err)
+	}
+
+	current, fields := takeSnapshot(pass.Fset, pass.Pkg)
+	for _, name := range old.names() {
+		keys, ok := current[name]
+		if !ok {
+			pass.Reportf(pass.Files[0].Package, "type %s of the API snapshot %s was removed, which breaks API compatibility", name, flagSnapshot)
+			continue
+		}
+		typePos := pass.Pkg.Scope().Lookup(name).Pos()
+		for _, key := range sortedKeys(old[name]) {
+			was := old[name][key]
+			now, ok := keys[key]
+			if !ok {
+				pass.Reportf(typePos, "json key %q of %s was removed or renamed, which breaks API compatibility", key, name)
+				continue
+			}
+			pos := fieldPos(pass, fields[name][key], typePos)
+			if now.Type != was.Type {
+				pass.Reportf(pos, "json key %q of %s changed type from %s to %s, which breaks API compatibility", key, name, was.Type, now.Type)
+			}
+			if now.OmitEmpty && !was.OmitEmpty {
+				pass.Reportf(pos, "json key %q of %s is now omitted when empty, which breaks API compatibility", key, name)
+			}
+		}
+	}
+	return nil
+}
+
+// isDependency returns whether the package in dir, analyzed by pass, belongs
+// to the standard library or to a versioned module, e.g. one in the module
+// cache.
+func isDependency(pass *analysis.Pass, dir string) bool {
+	if pass.Module != nil && pass.Module.Version != "" {
+		return true
+	}
+	goroot := filepath.Join(build.Default.GOROOT, "src") + string(filepath.Separator)
+	return strings.HasPrefix(dir+string(filepath.Separator), goroot)
+}
+
+// fieldPos returns the position of the field of the struct declaring f, or
+// def if the struct is declared in another package.
+func fieldPos(pass *analysis.Pass, f jsonField, def token.Pos) token.Pos {
+	if f.path == nil || f.path[0].Pkg() != pass.Pkg {
+		return def
+	}
+	return f.path[0].Pos()
+}
+
+// names returns the names of the types of the snapshot in sorted order.
+func (s snapshot) names() []string {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedKeys returns the json keys of a type of a snapshot in sorted order.
+func sortedKeys(keys map[string]snapshotKey) []string {
+	var sorted []string
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// isTestFile returns whether pos is in a test file.
+func isTestFile(fset *token.FileSet, pos token.Pos) bool {
+	return strings.HasSuffix(fset.Position(pos).Filename, "_test.go")
+}
+
+// hasTestFiles returns whether the package is analyzed along with its tests.
+func hasTestFiles(pass *analysis.Pass) bool {
+	for _, f := range pass.Files {
+		if isTestFile(pass.Fset, f.Pos()) {
+			return true
+		}
+	}
+	return false
+}
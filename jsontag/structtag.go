@@ -0,0 +1,73 @@
+package jsontag
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// tagPair is a key:"value" pair of a struct tag.
+type tagPair struct {
+	key   string
+	value string
+	// pos and end are the offsets of the quoted value in the struct tag.
+	pos, end int
+}
+
+// parseTag parses the key:"value" pairs of the struct tag raw. Unlike
+// reflect.StructTag.Lookup, which silently ignores the rest of a malformed
+// struct tag, it returns an error describing the malformation.
+func parseTag(raw string) ([]tagPair, error) {
+	var pairs []tagPair
+	seen := make(map[string]bool)
+	offset := 0
+	for offset < len(raw) {
+		// skip leading space
+		if offset > 0 && raw[offset] != ' ' {
+			return nil, errors.New("key:\"value\" pairs not separated by spaces")
+		}
+		for offset < len(raw) && raw[offset] == ' ' {
+			offset++
+		}
+		if offset == len(raw) {
+			break
+		}
+
+		// scan to colon
+		i := offset
+		for i < len(raw) && raw[i] > ' ' && raw[i] != ':' && raw[i] != '"' && raw[i] != 0x7f {
+			i++
+		}
+		if i == offset {
+			return nil, errors.New("bad syntax for struct tag key")
+		}
+		if i+1 >= len(raw) || raw[i] != ':' || raw[i+1] != '"' {
+			return nil, fmt.Errorf("bad syntax for struct tag pair %q", raw[offset:])
+		}
+		key := raw[offset:i]
+		offset = i + 1
+
+		// scan quoted string to find value
+		i = offset + 1
+		for i < len(raw) && raw[i] != '"' {
+			if raw[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(raw) {
+			return nil, fmt.Errorf("bad syntax for struct tag value of key %q", key)
+		}
+		value, err := strconv.Unquote(raw[offset : i+1])
+		if err != nil {
+			return nil, fmt.Errorf("bad syntax for struct tag value of key %q", key)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("struct tag key %q is repeated", key)
+		}
+		seen[key] = true
+		pairs = append(pairs, tagPair{key: key, value: value, pos: offset, end: i + 1})
+		offset = i + 1
+	}
+	return pairs, nil
+}
@@ -0,0 +1,38 @@
+package jsontag
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseTag probes the parseTag function
+func TestParseTag(t *testing.T) {
+	var tests = []struct {
+		raw   string
+		pairs []tagPair
+		err   string
+	}{
+		// Valid cases
+		{``, nil, ""},
+		{`json:"a"`, []tagPair{{"json", "a", 5, 8}}, ""},
+		{` json:"a,omitempty"  yaml:"\"b\""`, []tagPair{{"json", "a,omitempty", 6, 19}, {"yaml", `"b"`, 26, 33}}, ""},
+
+		// Invalid cases
+		{`json:a`, nil, `bad syntax for struct tag pair "json:a"`},
+		{`:"a"`, nil, "bad syntax for struct tag key"},
+		{`json:"a`, nil, `bad syntax for struct tag value of key "json"`},
+		{`json:"a"yaml:"b"`, nil, `key:"value" pairs not separated by spaces`},
+		{`json:"a" json:"b"`, nil, `struct tag key "json" is repeated`},
+	}
+
+	for _, test := range tests {
+		pairs, err := parseTag(test.raw)
+		var errStr string
+		if err != nil {
+			errStr = err.Error()
+		}
+		if !reflect.DeepEqual(pairs, test.pairs) || errStr != test.err {
+			t.Errorf("parseTag(%q) = %v, %q; expected %v, %q", test.raw, pairs, errStr, test.pairs, test.err)
+		}
+	}
+}
@@ -294,10 +294,35 @@ func isMutexType(t types.Type) bool {
 	return strings.HasSuffix(t.String(), "Mutex")
 }
 
+// staticFieldPrefixes are the first words of fields that can be treated as
+// static and don't need to be managed under a mutex
+var staticFieldPrefixes = []string{"static", "atomic"}
+
+// managedMethodPrefixes are the first words of methods that manage their own
+// locking, see managesOwnLocking
+var managedMethodPrefixes = []string{"extern", "managed", "threaded", "call"}
+
+// StaticFieldPrefixes returns the first words of fields that can be treated as
+// static and don't need to be managed under a mutex
+func StaticFieldPrefixes() []string {
+	return append([]string(nil), staticFieldPrefixes...)
+}
+
+// ManagedMethodPrefixes returns the first words of methods that manage their
+// own locking
+func ManagedMethodPrefixes() []string {
+	return append([]string(nil), managedMethodPrefixes...)
+}
+
 // isStaticField returns true if the field can be treated as static and doesn't
 // need to be managed under a mutex
 func isStaticField(name string) bool {
-	return firstWordIs(name, "static") || firstWordIs(name, "atomic")
+	for _, prefix := range staticFieldPrefixes {
+		if firstWordIs(name, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // isSyncObject is a helper to determing if the object is a sync package object
@@ -329,11 +354,15 @@ func isSyncObject(t types.Type) bool {
 //   - call is a synchronous method used by other subsystems
 //   - threaded is an asynchronous method
 func managesOwnLocking(name string) bool {
-	return isManagedExported(name) ||
-		firstWordIs(name, "extern") ||
-		firstWordIs(name, "managed") ||
-		firstWordIs(name, "threaded") ||
-		firstWordIs(name, "call")
+	if isManagedExported(name) {
+		return true
+	}
+	for _, prefix := range managedMethodPrefixes {
+		if firstWordIs(name, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // run implements the analysis interface
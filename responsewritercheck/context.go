@@ -0,0 +1,148 @@
+package responsewritercheck
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/cfg"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// contextFuncs are the functions deriving a context from their first argument
+var contextFuncs = map[string]bool{
+	"context.WithCancel":   true,
+	"context.WithDeadline": true,
+	"context.WithTimeout":  true,
+	"context.WithValue":    true,
+}
+
+// cancellationClauses returns the select cases within the handler fd that
+// receive from the Done channel of the context of the request tracked by rs,
+// e.g. case <-req.Context().Done().
+func cancellationClauses(info *types.Info, fd *ast.FuncDecl, rs derivedSet) []*ast.CommClause {
+	ctxs := trackContexts(info, fd.Body, rs)
+
+	var clauses []*ast.CommClause
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		cc, ok := n.(*ast.CommClause)
+		if !ok || cc.Comm == nil {
+			return true
+		}
+		var recv ast.Expr
+		switch comm := cc.Comm.(type) {
+		case *ast.ExprStmt:
+			recv = comm.X
+		case *ast.AssignStmt:
+			recv = comm.Rhs[0]
+		}
+		ue, ok := recv.(*ast.UnaryExpr)
+		if !ok || ue.Op != token.ARROW {
+			return true
+		}
+		done, ok := ue.X.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if se, ok := done.Fun.(*ast.SelectorExpr); ok && se.Sel.Name == "Done" && ctxs.isContext(info, se.X, rs) {
+			clauses = append(clauses, cc)
+		}
+		return true
+	})
+	return clauses
+}
+
+// contextSet is the set of variables holding the context of a request, or a
+// context derived from it.
+type contextSet map[types.Object]bool
+
+// trackContexts returns the contextSet of the request tracked by rs within
+// body, e.g. ctx := req.Context() or ctx, cancel :=
+// context.WithTimeout(req.Context(), time.Second).
+func trackContexts(info *types.Info, body ast.Node, rs derivedSet) contextSet {
+	ctxs := make(contextSet)
+	for changed := true; changed; {
+		changed = false
+		ast.Inspect(body, func(n ast.Node) bool {
+			as, ok := n.(*ast.AssignStmt)
+			if !ok || len(as.Rhs) != 1 {
+				return true
+			}
+			ident, ok := as.Lhs[0].(*ast.Ident)
+			if !ok || ident.Name == "_" {
+				return true
+			}
+			obj := info.ObjectOf(ident)
+			if obj != nil && !ctxs[obj] && ctxs.isContext(info, as.Rhs[0], rs) {
+				ctxs[obj] = true
+				changed = true
+			}
+			return true
+		})
+	}
+	return ctxs
+}
+
+// isContext returns true if e evaluates to the context of the request tracked
+// by rs, or to a context derived from it
+func (ctxs contextSet) isContext(info *types.Info, e ast.Expr, rs derivedSet) bool {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return ctxs[info.ObjectOf(e)]
+	case *ast.ParenExpr:
+		return ctxs.isContext(info, e.X, rs)
+	case *ast.CallExpr:
+		if se, ok := e.Fun.(*ast.SelectorExpr); ok && se.Sel.Name == "Context" && rs.derived(info, se.X) {
+			return true
+		}
+		if fn := typeutil.StaticCallee(info, e); fn != nil && contextFuncs[fn.FullName()] && len(e.Args) > 0 {
+			return ctxs.isContext(info, e.Args[0], rs)
+		}
+	}
+	return false
+}
+
+// checkCancellation reports the select cases of the handler fd, receiving
+// from the Done channel of the request context, that return without writing
+// an error to the writer tracked by ws. It returns the return statements that
+// were reported this way.
+func checkCancellation(f *facts, fd *ast.FuncDecl, ws, rs derivedSet) map[*ast.ReturnStmt]bool {
+	pass := f.pass
+	g := f.cfg(fd)
+	written := func(n ast.Node) bool { return f.writes(n, ws, writeConditional) }
+
+	reported := make(map[*ast.ReturnStmt]bool)
+	for _, cc := range cancellationClauses(pass.TypesInfo, fd, rs) {
+		if len(cc.Body) == 0 {
+			continue // falls through to the statements after the select
+		}
+		b := firstBlockWithin(g.Blocks, cc.Body[0].Pos(), cc.End())
+		if b == nil {
+			continue
+		}
+		rets := searchUnwritten(make(map[*cfg.Block]bool), []*cfg.Block{b}, written)
+		if len(rets) == 0 {
+			continue
+		}
+		for _, ret := range rets {
+			reported[ret] = true
+		}
+		pass.Reportf(cc.Pos(), "http handler %s returns without writing an error when the request context is cancelled", fd.Name.Name)
+	}
+	return reported
+}
+
+// firstBlockWithin returns the block holding the first CFG node that lies
+// within the source range [pos, end), or nil if there is none
+func firstBlockWithin(blocks []*cfg.Block, pos, end token.Pos) *cfg.Block {
+	var first *cfg.Block
+	firstPos := end
+	for _, b := range blocks {
+		for _, n := range b.Nodes {
+			if n.Pos() >= pos && n.Pos() < firstPos {
+				first, firstPos = b, n.Pos()
+			}
+		}
+	}
+	return first
+}
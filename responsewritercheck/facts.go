@@ -0,0 +1,230 @@
+package responsewritercheck
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/cfg"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// writeKind describes how a function uses its http.ResponseWriter param.
+type writeKind int
+
+const (
+	// writeNever means the function never writes the response, it merely
+	// wraps, inspects or forwards the writer (e.g. setCORSHeaders(w)).
+	writeNever writeKind = iota
+	// writeConditional means the function writes the response on some, but
+	// not all, of its paths.
+	writeConditional
+	// writeAlways means the function writes the response on every path.
+	writeAlways
+)
+
+// String implements fmt.Stringer.
+func (k writeKind) String() string {
+	switch k {
+	case writeNever:
+		return "never"
+	case writeConditional:
+		return "conditional"
+	case writeAlways:
+		return "always"
+	}
+	return "unknown"
+}
+
+// writeFact is exported for functions that receive an http.ResponseWriter but
+// do not always write the response. Callers in the same or other packages use
+// it to decide whether passing the writer to the function counts as writing the
+// response. Functions without a writeFact are assumed to always write.
+type writeFact struct {
+	Kind writeKind
+}
+
+// AFact implements analysis.Fact.
+func (*writeFact) AFact() {}
+
+// String implements fmt.Stringer.
+func (f *writeFact) String() string {
+	return "writes " + f.Kind.String()
+}
+
+// facts computes, exports and looks up the writeFacts of functions. It also
+// holds the CFGs shared by the checks of the package being analyzed.
+type facts struct {
+	pass *analysis.Pass
+
+	// decls holds the functions declared in the package being analyzed that
+	// receive an http.ResponseWriter, along with the writers tracked within
+	// them.
+	decls   map[*types.Func]*ast.FuncDecl
+	writers map[*types.Func]derivedSet
+
+	// kinds caches the computed writeKind of the functions in decls.
+	kinds map[*types.Func]writeKind
+
+	// cfgs caches the CFGs of the functions in decls, see cfg.
+	cfgs map[*ast.FuncDecl]*cfg.CFG
+
+	// closures holds the function literals stored in the local variables of
+	// the functions in decls, see storeClosures.
+	closures map[*types.Var]*ast.FuncLit
+
+	// inProgress marks functions whose writeKind is currently being computed,
+	// to break cycles of (mutually) recursive functions.
+	inProgress map[*types.Func]bool
+}
+
+// newFacts returns a facts for the package being analyzed by pass. The given
+// function declarations all receive an http.ResponseWriter.
+func newFacts(pass *analysis.Pass, fds []*ast.FuncDecl) *facts {
+	f := &facts{
+		pass:       pass,
+		decls:      make(map[*types.Func]*ast.FuncDecl),
+		writers:    make(map[*types.Func]derivedSet),
+		kinds:      make(map[*types.Func]writeKind),
+		cfgs:       make(map[*ast.FuncDecl]*cfg.CFG),
+		closures:   make(map[*types.Var]*ast.FuncLit),
+		inProgress: make(map[*types.Func]bool),
+	}
+	for _, fd := range fds {
+		fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+		if !ok {
+			continue
+		}
+		rw, _ := paramHTTPResponseWriter(pass.TypesInfo, fd)
+		f.decls[fn] = fd
+		f.writers[fn] = trackDerived(pass.TypesInfo, fd.Body, rw)
+		storeClosures(pass.TypesInfo, fd.Body, f.closures)
+	}
+	return f
+}
+
+// exportAll computes and exports the writeFact of every function declared in
+// the package.
+func (f *facts) exportAll() {
+	for fn := range f.decls {
+		f.kind(fn)
+	}
+}
+
+// kind returns how fn uses its http.ResponseWriter. Functions declared in other
+// packages without a fact, such as functions accepting an io.Writer, are
+// assumed to always write.
+func (f *facts) kind(fn *types.Func) writeKind {
+	if k, ok := f.kinds[fn]; ok {
+		return k
+	}
+	fd, ok := f.decls[fn]
+	if !ok {
+		var fact writeFact
+		if f.pass.ImportObjectFact(fn, &fact) {
+			return fact.Kind
+		}
+		return writeAlways
+	}
+	if f.inProgress[fn] {
+		return writeAlways
+	}
+
+	f.inProgress[fn] = true
+	k := f.compute(fd, f.writers[fn])
+	delete(f.inProgress, fn)
+
+	f.kinds[fn] = k
+	if k != writeAlways {
+		f.pass.ExportObjectFact(fn, &writeFact{Kind: k})
+	}
+	return k
+}
+
+// compute determines how fd uses the http.ResponseWriter tracked by ws by
+// walking its CFG.
+func (f *facts) compute(fd *ast.FuncDecl, ws derivedSet) writeKind {
+	g := f.cfg(fd)
+
+	mayWrite := false
+	for _, b := range g.Blocks {
+		if !b.Live {
+			continue
+		}
+		for _, n := range b.Nodes {
+			if f.writes(n, ws, writeConditional) {
+				mayWrite = true
+			}
+		}
+	}
+	if !mayWrite {
+		return writeNever
+	}
+
+	visited := make(map[*cfg.Block]bool)
+	always := func(n ast.Node) bool { return f.writes(n, ws, writeAlways) }
+	if len(searchUnwritten(visited, g.Blocks[:1], always)) == 0 {
+		return writeAlways
+	}
+	return writeConditional
+}
+
+// callWrites returns true if passing the writer to the given call writes the
+// response with at least the given kind.
+func (f *facts) callWrites(ce *ast.CallExpr, min writeKind) bool {
+	if tv, ok := f.pass.TypesInfo.Types[ce.Fun]; ok && tv.IsType() {
+		return false // a type conversion, e.g. http.ResponseWriter(w)
+	}
+	fn := typeutil.StaticCallee(f.pass.TypesInfo, ce)
+	if fn == nil {
+		return true // callee not statically known; be conservative
+	}
+	return f.kind(fn) >= min
+}
+
+// closure returns the function literal stored in the local variable called by
+// ce, if any.
+func (f *facts) closure(ce *ast.CallExpr) *ast.FuncLit {
+	id, ok := ce.Fun.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	v, _ := f.pass.TypesInfo.Uses[id].(*types.Var)
+	return f.closures[v]
+}
+
+// writes returns true if the given node contains a call that writes to one of
+// the given writers with at least the given kind, either by passing it as an
+// argument or by calling its Write, WriteHeader or Flush method. Calls of
+// function literals stored in local variables write if the literal does, and
+// function literals are only descended into if called immediately, see
+// inspectCalled.
+func (f *facts) writes(n ast.Node, ws derivedSet, min writeKind) bool {
+	info := f.pass.TypesInfo
+
+	var found bool
+	inspectCalled(n, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		ce, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if lit := f.closure(ce); lit != nil {
+			found = f.writes(lit.Body, ws, min)
+			return !found
+		}
+		if se, ok := ce.Fun.(*ast.SelectorExpr); ok && ws.derived(info, se.X) {
+			found = se.Sel.Name == "Write" || se.Sel.Name == "WriteHeader" || se.Sel.Name == "Flush"
+			return !found
+		}
+		for _, arg := range ce.Args {
+			if ws.derived(info, arg) {
+				found = f.callWrites(ce, min)
+			}
+		}
+		return !found
+	})
+	return found
+}
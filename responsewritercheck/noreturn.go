@@ -0,0 +1,102 @@
+package responsewritercheck
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis/passes/ctrlflow"
+	"golang.org/x/tools/go/cfg"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// noReturnFuncs are the functions that never return to the caller. The CFG
+// built by ctrlflow already ends a path at most of them, but not at
+// build.Critical, which only panics in debug builds.
+var noReturnFuncs = map[string]bool{
+	"gitlab.com/NebulousLabs/Sia/build.Critical": true,
+	"go.sia.tech/siad/build.Critical":            true,
+	"log.Fatal":                                  true,
+	"log.Fatalf":                                 true,
+	"log.Fatalln":                                true,
+	"log.Panic":                                  true,
+	"log.Panicf":                                 true,
+	"log.Panicln":                                true,
+	"(*log.Logger).Fatal":                        true,
+	"(*log.Logger).Fatalf":                       true,
+	"(*log.Logger).Fatalln":                      true,
+	"(*log.Logger).Panic":                        true,
+	"(*log.Logger).Panicf":                       true,
+	"(*log.Logger).Panicln":                      true,
+	"os.Exit":                                    true,
+	"runtime.Goexit":                             true,
+}
+
+// cfg returns the CFG of fd in which every path ends at a call that never
+// returns, see terminates. The CFG is cached, as every check walks it.
+func (f *facts) cfg(fd *ast.FuncDecl) *cfg.CFG {
+	if g, ok := f.cfgs[fd]; ok {
+		return g
+	}
+	cfgs := f.pass.ResultOf[ctrlflow.Analyzer].(*ctrlflow.CFGs)
+	g := pruneCFG(cfgs.FuncDecl(fd), func(n ast.Node) bool {
+		return terminates(f.pass.TypesInfo, n)
+	})
+	f.cfgs[fd] = g
+	return g
+}
+
+// terminates returns true if n is a call statement that never returns, such
+// as panic, os.Exit, log.Fatal or build.Critical
+func terminates(info *types.Info, n ast.Node) bool {
+	es, ok := n.(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	ce, ok := es.X.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	if ident, ok := ce.Fun.(*ast.Ident); ok {
+		if b, ok := info.Uses[ident].(*types.Builtin); ok && b.Name() == "panic" {
+			return true
+		}
+	}
+	fn := typeutil.StaticCallee(info, ce)
+	return fn != nil && noReturnFuncs[fn.FullName()]
+}
+
+// pruneCFG returns a copy of g in which every block holding a node satisfying
+// terminates has no successors. The nodes of the block are kept, as
+// build.Critical returns in release builds and the nodes following it are still
+// executed, e.g. writing the error. The liveness of the blocks is recomputed
+// accordingly. g itself is shared with other analyzers, and is left untouched.
+func pruneCFG(g *cfg.CFG, terminates func(ast.Node) bool) *cfg.CFG {
+	pruned := &cfg.CFG{Blocks: make([]*cfg.Block, len(g.Blocks))}
+	for i, b := range g.Blocks {
+		pruned.Blocks[i] = &cfg.Block{
+			Nodes: b.Nodes,
+			Index: b.Index,
+		}
+	}
+	for i, b := range g.Blocks {
+		p := pruned.Blocks[i]
+		if containsNode(b.Nodes, terminates) {
+			continue
+		}
+		for _, succ := range b.Succs {
+			p.Succs = append(p.Succs, pruned.Blocks[succ.Index])
+		}
+	}
+
+	// recompute liveness, i.e. reachability from the entry block
+	q := []*cfg.Block{pruned.Blocks[0]}
+	for len(q) > 0 {
+		b := q[len(q)-1]
+		q = q[:len(q)-1]
+		if !b.Live {
+			b.Live = true
+			q = append(q, b.Succs...)
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,239 @@
+package responsewritercheck
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/cfg"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// formMethods are the methods of *http.Request that parse the request form,
+// which consumes the body of POST, PUT and PATCH requests.
+var formMethods = map[string]bool{
+	"FormFile":           true,
+	"FormValue":          true,
+	"MultipartReader":    true,
+	"ParseForm":          true,
+	"ParseMultipartForm": true,
+	"PostFormValue":      true,
+}
+
+// checkRequest checks the handling of the request body by the handler fd,
+// whose writer is tracked by ws and whose *http.Request is tracked by rs. It
+// reports:
+//   - bodies that are read more than once
+//   - errors from decoding the body that are ignored, or only checked after
+//     writing the response
+//   - requests whose form is parsed on the same path the body is read
+func checkRequest(f *facts, fd *ast.FuncDecl, ws, rs derivedSet) {
+	pass := f.pass
+	info := pass.TypesInfo
+	g := f.cfg(fd)
+
+	readsBody := func(n ast.Node) bool { return len(bodyReads(info, n, rs)) > 0 }
+	parsesForm := func(n ast.Node) bool { return len(formCalls(info, n, rs)) > 0 }
+
+	for _, b := range g.Blocks {
+		if !b.Live {
+			continue
+		}
+		for i, n := range b.Nodes {
+			for _, ce := range bodyReads(info, n, rs) {
+				reportPair(pass, b, i, ce, readsBody, "request body read more than once", "request body read again here")
+				reportPair(pass, b, i, ce, parsesForm, "request body read on the same path the request form is parsed", "request form parsed here")
+				checkDecodeError(f, b, i, ws, ce)
+			}
+			for _, ce := range formCalls(info, n, rs) {
+				reportPair(pass, b, i, ce, readsBody, "request form parsed on the same path the request body is read", "request body read here")
+			}
+		}
+	}
+}
+
+// reportPair reports call, found within the i-th node of b, if a node
+// satisfying pred is reached on a path after it.
+func reportPair(pass *analysis.Pass, b *cfg.Block, i int, call *ast.CallExpr, pred func(ast.Node) bool, msg, relatedMsg string) {
+	var matches []match
+	if n := firstNode(b.Nodes[i+1:], pred); n != nil {
+		matches = append(matches, match{node: n})
+	} else {
+		matches = searchAll(make(map[*cfg.Block]bool), b.Succs, nil, pred)
+	}
+	if len(matches) == 0 {
+		return
+	}
+	pass.Report(analysis.Diagnostic{
+		Pos:     call.Pos(),
+		Message: msg,
+		Related: matches[0].related(relatedMsg),
+	})
+}
+
+// checkDecodeError checks the error returned by decoding the request body
+// with the body read ce, found within the i-th node of b. The error should be
+// assigned to a variable, which is checked before writing the response.
+func checkDecodeError(f *facts, b *cfg.Block, i int, ws derivedSet, ce *ast.CallExpr) {
+	pass := f.pass
+	info := pass.TypesInfo
+
+	decode, errVar, ok := decodeCall(info, b.Nodes[i], ce)
+	if !ok {
+		return
+	}
+	if errVar == nil {
+		pass.Reportf(decode.Pos(), "error from decoding the request body is not checked")
+		return
+	}
+
+	usesErr := func(n ast.Node) bool {
+		var found bool
+		ast.Inspect(n, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && info.Uses[ident] == errVar {
+				found = true
+			}
+			return !found
+		})
+		return found
+	}
+	// the first node on every path that checks the error or writes the
+	// response, a node that does both (e.g. WriteError(w, err)) checks it
+	pred := func(n ast.Node) bool { return usesErr(n) || f.writes(n, ws, writeConditional) }
+
+	var matches []match
+	if n := firstNode(b.Nodes[i+1:], pred); n != nil {
+		matches = append(matches, match{node: n})
+	} else {
+		matches = searchAll(make(map[*cfg.Block]bool), b.Succs, nil, pred)
+	}
+	for _, m := range matches {
+		if usesErr(m.node) {
+			continue
+		}
+		pass.Report(analysis.Diagnostic{
+			Pos:     m.node.Pos(),
+			Message: "response written before checking the error from decoding the request body",
+			Related: []analysis.RelatedInformation{{
+				Pos:     decode.Pos(),
+				End:     decode.End(),
+				Message: "request body decoded here",
+			}},
+		})
+	}
+}
+
+// decodeCall looks for the call decoding the request body read by ce within
+// the CFG node n, i.e. json.NewDecoder(req.Body).Decode(&v), and returns it
+// along with the variable its error is assigned to. The variable is nil if the
+// error is discarded.
+func decodeCall(info *types.Info, n ast.Node, ce *ast.CallExpr) (*ast.CallExpr, types.Object, bool) {
+	var decode *ast.CallExpr
+	ast.Inspect(n, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || decode != nil {
+			return decode == nil
+		}
+		se, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || se.X != ast.Expr(ce) {
+			return true
+		}
+		if fn := typeutil.StaticCallee(info, call); fn != nil && fn.FullName() == "(*encoding/json.Decoder).Decode" {
+			decode = call
+		}
+		return true
+	})
+	if decode == nil {
+		return nil, nil, false
+	}
+
+	switch s := n.(type) {
+	case *ast.AssignStmt:
+		for i, rhs := range s.Rhs {
+			if rhs != ast.Expr(decode) || i >= len(s.Lhs) {
+				continue
+			}
+			if ident, ok := s.Lhs[i].(*ast.Ident); ok && ident.Name != "_" {
+				return decode, info.ObjectOf(ident), true
+			}
+		}
+		return decode, nil, true
+	case *ast.ExprStmt:
+		return decode, nil, true
+	}
+	// the error is used in another way, e.g. returned or passed on directly
+	return nil, nil, false
+}
+
+// bodyReads returns the calls within n that read the body of one of the given
+// requests, such as json.NewDecoder(req.Body) or ioutil.ReadAll(req.Body).
+// Calls wrapping the body in another reader, such as http.MaxBytesReader, do
+// not read it. Function literals are not descended into.
+func bodyReads(info *types.Info, n ast.Node, rs derivedSet) []*ast.CallExpr {
+	var calls []*ast.CallExpr
+	ast.Inspect(n, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		ce, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if se, ok := ce.Fun.(*ast.SelectorExpr); ok && se.Sel.Name == "Read" && isBody(info, se.X, rs) {
+			calls = append(calls, ce)
+			return true
+		}
+		for _, arg := range ce.Args {
+			if isBody(info, arg, rs) && !returnsReader(info, ce) {
+				calls = append(calls, ce)
+				break
+			}
+		}
+		return true
+	})
+	return calls
+}
+
+// isBody returns true if e is the Body field of one of the given requests
+func isBody(info *types.Info, e ast.Expr, rs derivedSet) bool {
+	se, ok := e.(*ast.SelectorExpr)
+	return ok && se.Sel.Name == "Body" && rs.derived(info, se.X)
+}
+
+// returnsReader returns true if the call returns a value with a Read method,
+// i.e. it wraps its argument in another reader
+func returnsReader(info *types.Info, ce *ast.CallExpr) bool {
+	t := info.TypeOf(ce)
+	if t == nil {
+		return false
+	}
+	if tuple, ok := t.(*types.Tuple); ok {
+		if tuple.Len() == 0 {
+			return false
+		}
+		t = tuple.At(0).Type()
+	}
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, "Read")
+	_, isMethod := obj.(*types.Func)
+	return isMethod
+}
+
+// formCalls returns the calls within n that parse the form of one of the
+// given requests. Function literals are not descended into.
+func formCalls(info *types.Info, n ast.Node, rs derivedSet) []*ast.CallExpr {
+	var calls []*ast.CallExpr
+	ast.Inspect(n, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		ce, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if se, ok := ce.Fun.(*ast.SelectorExpr); ok && formMethods[se.Sel.Name] && rs.derived(info, se.X) {
+			calls = append(calls, ce)
+		}
+		return true
+	})
+	return calls
+}
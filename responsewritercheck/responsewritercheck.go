@@ -1,5 +1,7 @@
 // Package responsewritercheck checks that HTTP handlers do not pass the
-// http.ResponseWriter to more than one function
+// http.ResponseWriter to more than one function, that every path through a
+// handler writes a response, and that handlers otherwise use the
+// http.ResponseWriter and *http.Request conventionally
 package responsewritercheck
 
 import (
@@ -13,12 +15,36 @@ import (
 	"golang.org/x/tools/go/cfg"
 )
 
+// Doc is the CLI help text for the responsewritercheck analyzer.
+const Doc = `reports misuse of the http.ResponseWriter in HTTP handlers
+
+Handlers should pass the http.ResponseWriter to at most one function that
+writes the response, should write a response on every path (including when the
+request context is cancelled), and should not modify the header after the
+response was written. Status codes should be written using the http.Status*
+constants, responses without a body should not write one, and JSON responses
+should not be given another Content-Type.
+
+Handlers should read the request body at most once, check the error from
+decoding it before writing the response, and not parse the request form on the
+same path the body is read.
+
+Streaming handlers, annotated with //responsewritercheck:streaming or flushing
+the writer through http.Flusher, may write chunks of the body any number of
+times, but should not write the whole response once streaming has begun.
+
+Paths end at calls that never return, such as panic, os.Exit, log.Fatal and
+build.Critical.`
+
 // Analyzer defines the responsewritercheck analysis tool, allowing it to be
 // used with the analysis framework.
 var Analyzer = &analysis.Analyzer{
 	Name: "responsewritercheck",
-	Doc:  "reports instances where HTTP handlers pass the http.Responsewriter to more than one function",
+	Doc:  Doc,
 	Run:  run,
+	FactTypes: []analysis.Fact{
+		new(writeFact),
+	},
 	Requires: []*analysis.Analyzer{
 		inspect.Analyzer,
 		ctrlflow.Analyzer,
@@ -37,69 +63,277 @@ func (f VisitorFunc) Visit(n ast.Node) ast.Visitor {
 // responsewritercheck reports a failure when an HTTP handler passes the
 // ResponseWriter to more than one function. Passing it to more than one
 // function can lead to errors where the header is written multiple times,
-// resulting in failure.
+// resulting in failure. It also reports handlers that can return without
+// writing a response.
 func run(pass *analysis.Pass) (interface{}, error) {
-	// fast path, skip if net/http is not imported
-	if !imports(pass.Pkg, "net/http") {
+	// fast path, skip if net/http is not imported, net/http itself is analyzed
+	// to compute the facts of helpers such as http.MaxBytesReader
+	if !imports(pass.Pkg, "net/http") && pass.Pkg.Path() != "net/http" {
 		return nil, nil
 	}
 
 	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
 
+	// Collect all functions receiving an http.ResponseWriter, and compute
+	// whether they write the response before checking any of them.
+	var fds []*ast.FuncDecl
 	filter := []ast.Node{(*ast.FuncDecl)(nil)}
 	inspect.Preorder(filter, func(node ast.Node) {
 		fd := node.(*ast.FuncDecl)
-		rw, exists := paramHTTPResponseWriter(pass.TypesInfo, fd)
-		if !exists {
-			return
+		if fd.Body == nil {
+			return // declared without body, e.g. implemented in assembly
+		}
+		if _, exists := paramHTTPResponseWriter(pass.TypesInfo, fd); exists {
+			fds = append(fds, fd)
 		}
-		runFunc(pass, fd, rw)
 	})
+	f := newFacts(pass, fds)
+	f.exportAll()
+
+	for _, fd := range fds {
+		ws := f.writers[pass.TypesInfo.Defs[fd.Name].(*types.Func)]
+		streaming := isStreaming(pass.TypesInfo, fd, ws)
+		runFunc(f, fd, ws, streaming)
+		checkHeaderAfterWrite(f, fd, ws)
+		checkStatus(f, fd, ws)
+		if streaming {
+			checkStreaming(f, fd, ws)
+		}
+		if req, ok := handlerRequest(pass.TypesInfo, fd); ok {
+			rs := trackDerived(pass.TypesInfo, fd.Body, req)
+			cancelled := checkCancellation(f, fd, ws, rs)
+			checkMissingWrite(f, fd, ws, cancelled)
+			checkRequest(f, fd, ws, rs)
+		}
+	}
 
 	return nil, nil
 }
 
-// runFunc checks the usage of responseWriter within fd.
-func runFunc(pass *analysis.Pass, fd *ast.FuncDecl, responseWriter *types.Var) {
-	// Find all expression staments that use the http.ResponseWriter
-	var usages []ast.Node
-	var v ast.Visitor
-	v = VisitorFunc(func(node ast.Node) ast.Visitor {
-		if passesArgument(pass.TypesInfo, node, responseWriter) {
-			usages = append(usages, node)
+// runFunc checks the usage of the http.ResponseWriter tracked by ws within fd.
+// Streaming functions may write chunks of the response body any number of
+// times, only the usages writing the whole response are checked.
+func runFunc(f *facts, fd *ast.FuncDecl, ws derivedSet, streaming bool) {
+	pass := f.pass
+
+	// Find all calls that pass the http.ResponseWriter
+	var usages []*ast.CallExpr
+	for _, call := range writingCalls(f, fd.Body, ws) {
+		if !streaming || !isChunkWrite(pass.TypesInfo, call, ws) {
+			usages = append(usages, call)
 		}
-		return v
-	})
-	ast.Walk(v, fd.Body)
+	}
 
 	// Obtain the CFG
-	cfgs := pass.ResultOf[ctrlflow.Analyzer].(*ctrlflow.CFGs)
-	g := cfgs.FuncDecl(fd)
+	g := f.cfg(fd)
 
-	// Loop over all statements and:
-	// - find the block in which it was defined
+	// Loop over all calls and:
+	// - find the CFG node enclosing it, and the block of that node
 	// - find if the next nodes in that block pass the ResponseWriter
 	// - find if any node on the CFG successor path passes the ResponseWriter
-	for _, stmt := range usages {
-		defBlock, atIndex := defBlock(g.Blocks, stmt)
+	passes := func(n ast.Node) bool {
+		for _, call := range writingCalls(f, n, ws) {
+			if !streaming || !isChunkWrite(pass.TypesInfo, call, ws) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, call := range usages {
+		// a conditional write guarding a return, e.g. if !checkAuth(w, req) {
+		// return }, only writes the response on the path that returns
+		if !f.callWrites(call, writeAlways) && guardsReturn(fd.Body, call) {
+			continue
+		}
+		defBlock, atIndex := enclosingNode(g.Blocks, call)
 		if defBlock == nil {
-			panic("could not find block where expression is defined")
+			pass.Reportf(call.Pos(), "internal error: could not locate http.Responsewriter usage in the control flow graph")
+			continue
+		}
+
+		// the first later node in the same block is the conflicting write on
+		// every path, otherwise every successor path may hold its own
+		var matches []match
+		if n := firstNode(defBlock.Nodes[atIndex+1:], passes); n != nil {
+			matches = append(matches, match{node: n})
+		} else {
+			visited := make(map[*cfg.Block]bool)
+			matches = searchAll(visited, defBlock.Succs, nil, passes)
+		}
+		for _, m := range matches {
+			// reaching the call again means it is on a loop's back-edge
+			if m.node == defBlock.Nodes[atIndex] {
+				reportLoop(pass, fd, call)
+				continue
+			}
+			pass.Report(analysis.Diagnostic{
+				Pos:     call.Pos(),
+				Message: "http.Responsewriter passed to more than one function",
+				Related: m.related("http.Responsewriter passed again here"),
+			})
+		}
+	}
+}
+
+// reportLoop reports that call, which writes the response, is executed again
+// on a later iteration of the loop enclosing it.
+func reportLoop(pass *analysis.Pass, fd *ast.FuncDecl, call *ast.CallExpr) {
+	d := analysis.Diagnostic{
+		Pos:     call.Pos(),
+		Message: "http.Responsewriter written inside loop",
+	}
+	if loop := enclosingLoop(fd.Body, call); loop != nil {
+		d.Related = []analysis.RelatedInformation{{
+			Pos:     loop.Pos(),
+			End:     loop.End(),
+			Message: "the loop writing the response more than once",
+		}}
+	}
+	pass.Report(d)
+}
+
+// enclosingLoop returns the innermost for or range statement within body that
+// encloses n, or nil if there is none (e.g. when looping through a goto)
+func enclosingLoop(body *ast.BlockStmt, n ast.Node) ast.Stmt {
+	var loop ast.Stmt
+	ast.Inspect(body, func(node ast.Node) bool {
+		if node == nil || node.Pos() > n.Pos() || n.End() > node.End() {
+			return false
+		}
+		switch s := node.(type) {
+		case *ast.ForStmt:
+			loop = s
+		case *ast.RangeStmt:
+			loop = s
+		}
+		return true
+	})
+	return loop
+}
+
+// guardsReturn returns true if call is part of the condition, or the init
+// statement, of an if statement within body of which a branch ends in a return
+// statement.
+func guardsReturn(body *ast.BlockStmt, call *ast.CallExpr) bool {
+	var guards bool
+	ast.Inspect(body, func(node ast.Node) bool {
+		if guards || node == nil || node.Pos() > call.Pos() || call.End() > node.End() {
+			return false
 		}
-		nodes := defBlock.Nodes[atIndex+1:]
+		is, ok := node.(*ast.IfStmt)
+		if !ok || !(encloses(is.Cond, call) || is.Init != nil && encloses(is.Init, call)) {
+			return true
+		}
+		guards = endsInReturn(is.Body)
+		if els, ok := is.Else.(*ast.BlockStmt); ok {
+			guards = guards || endsInReturn(els)
+		}
+		return false
+	})
+	return guards
+}
+
+// encloses returns true if the source range of outer spans that of inner
+func encloses(outer, inner ast.Node) bool {
+	return outer.Pos() <= inner.Pos() && inner.End() <= outer.End()
+}
+
+// endsInReturn returns true if the last statement of block is a return
+// statement
+func endsInReturn(block *ast.BlockStmt) bool {
+	if len(block.List) == 0 {
+		return false
+	}
+	_, ok := block.List[len(block.List)-1].(*ast.ReturnStmt)
+	return ok
+}
+
+// checkHeaderAfterWrite reports header mutations and WriteHeader calls within
+// fd that occur on a CFG path after the response has been written. At that
+// point the header has already been sent, so they silently have no effect.
+func checkHeaderAfterWrite(f *facts, fd *ast.FuncDecl, ws derivedSet) {
+	pass := f.pass
+	g := f.cfg(fd)
+
+	// only writes that happen on every path of a callee start the response,
+	// a callee that conditionally writes usually returns whether it did
+	started := func(n ast.Node) bool { return f.writes(n, ws, writeAlways) }
+
+	reported := make(map[*ast.CallExpr]bool)
+	report := func(n ast.Node) bool {
+		for _, ce := range headerMutations(pass.TypesInfo, n, ws) {
+			if reported[ce] {
+				continue
+			}
+			reported[ce] = true
+			if se := ce.Fun.(*ast.SelectorExpr); se.Sel.Name == "WriteHeader" {
+				pass.Reportf(ce.Pos(), "http.ResponseWriter.WriteHeader called after the response was written")
+			} else {
+				pass.Reportf(ce.Pos(), "http.ResponseWriter header modified after the response was written")
+			}
+		}
+		// keep searching, every reachable mutation is reported
+		return false
+	}
 
-		for _, n := range nodes {
-			if passesArgument(pass.TypesInfo, n, responseWriter) {
-				pass.Reportf(stmt.Pos(), "http.Responsewriter passed to more than one function")
+	for _, b := range g.Blocks {
+		if !b.Live {
+			continue
+		}
+		for i, n := range b.Nodes {
+			if !started(n) {
+				continue
 			}
+			containsNode(b.Nodes[i+1:], report)
+			search(make(map[*cfg.Block]bool), b.Succs, report)
 		}
+	}
+}
+
+// checkMissingWrite reports every return statement of the handler fd that can
+// be reached from the entry of the function without writing a response. A
+// handler that returns without writing results in an implicit 200 with an
+// empty body, which confuses clients. Return statements that were already
+// reported by checkCancellation are skipped.
+func checkMissingWrite(f *facts, fd *ast.FuncDecl, ws derivedSet, cancelled map[*ast.ReturnStmt]bool) {
+	pass := f.pass
+	g := f.cfg(fd)
 
-		visited := make(map[*cfg.Block]bool)
-		if found := search(pass.TypesInfo, visited, defBlock.Succs, responseWriter); found != nil {
-			pass.Reportf(stmt.Pos(), "http.Responsewriter passed to more than one function")
+	// functions that only conditionally write are given the benefit of the doubt
+	written := func(n ast.Node) bool { return f.writes(n, ws, writeConditional) }
+	visited := make(map[*cfg.Block]bool)
+	for _, ret := range searchUnwritten(visited, g.Blocks[:1], written) {
+		if cancelled[ret] {
+			continue
 		}
+		pass.Reportf(ret.Pos(), "http handler %s returns without writing a response", fd.Name.Name)
 	}
 }
 
+// searchUnwritten walks the CFG path of successor blocks and returns the return
+// statements that are reached without passing a node for which written returns
+// true
+func searchUnwritten(visited map[*cfg.Block]bool, blocks []*cfg.Block, written func(ast.Node) bool) []*ast.ReturnStmt {
+	var rets []*ast.ReturnStmt
+	for _, b := range blocks {
+		if visited[b] {
+			continue
+		}
+		visited[b] = true
+
+		if containsNode(b.Nodes, written) {
+			continue
+		}
+		if ret := b.Return(); ret != nil {
+			rets = append(rets, ret)
+			continue
+		}
+		rets = append(rets, searchUnwritten(visited, b.Succs, written)...)
+	}
+
+	return rets
+}
+
 // imports returns true if the given path is being imported
 func imports(pkg *types.Package, path string) bool {
 	for _, imp := range pkg.Imports() {
@@ -112,11 +346,36 @@ func imports(pkg *types.Package, path string) bool {
 
 // paramHTTPResponseWriter returns the http.ResponseWriter param
 func paramHTTPResponseWriter(info *types.Info, fd *ast.FuncDecl) (*types.Var, bool) {
-	for i, fld := range fd.Type.Params.List {
+	// a field declares one param per name, e.g. a, b int, or a single
+	// unnamed param
+	i := 0
+	for _, fld := range fd.Type.Params.List {
 		if isHTTPResponseWriter(info, fld) {
 			sig, _ := info.Defs[fd.Name].Type().(*types.Signature)
 			return sig.Params().At(i), true
 		}
+		if len(fld.Names) == 0 {
+			i++
+		}
+		i += len(fld.Names)
+	}
+	return nil, false
+}
+
+// handlerRequest returns the *http.Request param if fd is an HTTP handler. A
+// function without results receiving both an http.ResponseWriter and an
+// *http.Request is an HTTP handler. Functions with results, e.g.
+// checkAuth(w, req) bool, are helpers that only write the response on some
+// paths and report to the caller whether they did.
+func handlerRequest(info *types.Info, fd *ast.FuncDecl) (*types.Var, bool) {
+	sig, _ := info.Defs[fd.Name].Type().(*types.Signature)
+	if sig.Results().Len() > 0 {
+		return nil, false
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		if p := sig.Params().At(i); p.Type().String() == "*net/http.Request" {
+			return p, true
+		}
 	}
 	return nil, false
 }
@@ -130,9 +389,9 @@ func isHTTPResponseWriter(info *types.Info, f *ast.Field) bool {
 	return tv.Type.String() == "net/http.ResponseWriter"
 }
 
-// search will walk the CFG path of successor blocks looking for nodes that pass
-// the given variable as argument
-func search(info *types.Info, visited map[*cfg.Block]bool, blocks []*cfg.Block, v *types.Var) ast.Node {
+// search will walk the CFG path of successor blocks looking for a node that
+// satisfies pred
+func search(visited map[*cfg.Block]bool, blocks []*cfg.Block, pred func(ast.Node) bool) ast.Node {
 	for _, b := range blocks {
 		if visited[b] {
 			continue
@@ -140,11 +399,11 @@ func search(info *types.Info, visited map[*cfg.Block]bool, blocks []*cfg.Block,
 		visited[b] = true
 
 		for _, n := range b.Nodes {
-			if passesArgument(info, n, v) {
+			if pred(n) {
 				return n
 			}
 		}
-		if rec := search(info, visited, b.Succs, v); rec != nil {
+		if rec := search(visited, b.Succs, pred); rec != nil {
 			return rec
 		}
 	}
@@ -152,47 +411,202 @@ func search(info *types.Info, visited map[*cfg.Block]bool, blocks []*cfg.Block,
 	return nil
 }
 
-// debBlock returns the block (and node index) where the given node was defined
-func defBlock(blocks []*cfg.Block, node ast.Node) (*cfg.Block, int) {
+// match is a node found by searchAll, along with the path of blocks leading to
+// it.
+type match struct {
+	node ast.Node
+	path []*cfg.Block
+}
+
+// related returns the related information of a diagnostic about the node that
+// was matched. It points at every block on the path to the node, followed by
+// the node itself, described by msg.
+func (m match) related(msg string) []analysis.RelatedInformation {
+	var related []analysis.RelatedInformation
+	for _, b := range m.path {
+		if len(b.Nodes) == 0 {
+			continue
+		}
+		related = append(related, analysis.RelatedInformation{
+			Pos:     b.Nodes[0].Pos(),
+			End:     b.Nodes[0].End(),
+			Message: "on the path to the conflicting call",
+		})
+	}
+	return append(related, analysis.RelatedInformation{
+		Pos:     m.node.Pos(),
+		End:     m.node.End(),
+		Message: msg,
+	})
+}
+
+// searchAll walks the CFG path of successor blocks and returns, for every
+// path, the first node that satisfies pred. The path from the given blocks up
+// to, but excluding, the block holding the node is recorded in the match.
+func searchAll(visited map[*cfg.Block]bool, blocks []*cfg.Block, path []*cfg.Block, pred func(ast.Node) bool) []match {
+	var matches []match
 	for _, b := range blocks {
-		for i, n := range b.Nodes {
-			if n == node {
-				return b, i
-			}
+		if visited[b] {
+			continue
+		}
+		visited[b] = true
+
+		if n := firstNode(b.Nodes, pred); n != nil {
+			matches = append(matches, match{
+				node: n,
+				path: append([]*cfg.Block(nil), path...),
+			})
+			continue
 		}
+		matches = append(matches, searchAll(visited, b.Succs, append(path, b), pred)...)
 	}
-	return nil, -1
+	return matches
 }
 
-// passesArgument returns a function that returns true if the given node is a
-// call expression that has the given var as one of its arguments
-func passesArgument(info *types.Info, n ast.Node, v *types.Var) bool {
-	if n == nil {
+// headerMutations returns the calls within n that modify the header of one of
+// the given writers, that is w.Header().Set, Add or Del, and w.WriteHeader.
+// Function literals are not descended into.
+func headerMutations(info *types.Info, n ast.Node, ws derivedSet) []*ast.CallExpr {
+	var calls []*ast.CallExpr
+	ast.Inspect(n, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		ce, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		se, ok := ce.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		switch se.Sel.Name {
+		case "WriteHeader":
+			if ws.derived(info, se.X) {
+				calls = append(calls, ce)
+			}
+		case "Set", "Add", "Del":
+			if isHeaderCall(info, se.X, ws) {
+				calls = append(calls, ce)
+			}
+		}
+		return true
+	})
+	return calls
+}
+
+// isHeaderCall returns true if e is a call to the Header method of one of the
+// given writers
+func isHeaderCall(info *types.Info, e ast.Expr, ws derivedSet) bool {
+	ce, ok := e.(*ast.CallExpr)
+	if !ok {
 		return false
 	}
+	se, ok := ce.Fun.(*ast.SelectorExpr)
+	return ok && se.Sel.Name == "Header" && ws.derived(info, se.X)
+}
 
-	var es *ast.ExprStmt
-	switch d := n.(type) {
-	case *ast.ExprStmt:
-		es = d
-	default:
-		return false
+// containsNode returns true if any of the given nodes satisfies pred
+func containsNode(nodes []ast.Node, pred func(ast.Node) bool) bool {
+	return firstNode(nodes, pred) != nil
+}
+
+// firstNode returns the first of the given nodes that satisfies pred, or nil
+func firstNode(nodes []ast.Node, pred func(ast.Node) bool) ast.Node {
+	for _, n := range nodes {
+		if pred(n) {
+			return n
+		}
 	}
+	return nil
+}
 
-	ce, ok := es.X.(*ast.CallExpr)
-	if !ok {
-		return false
+// enclosingNode returns the block (and node index) of the innermost CFG node
+// enclosing the given node. The given node may be nested within a CFG node,
+// e.g. within the init statement of an if statement or within a function
+// literal that is called immediately.
+func enclosingNode(blocks []*cfg.Block, node ast.Node) (*cfg.Block, int) {
+	var enclosing *cfg.Block
+	atIndex := -1
+	for _, b := range blocks {
+		for i, n := range b.Nodes {
+			if n.Pos() > node.Pos() || node.End() > n.End() {
+				continue
+			}
+			if enclosing != nil && nodeLen(n) >= nodeLen(enclosing.Nodes[atIndex]) {
+				continue
+			}
+			enclosing, atIndex = b, i
+		}
 	}
+	return enclosing, atIndex
+}
 
-	for _, arg := range ce.Args {
-		ident, ok := arg.(*ast.Ident)
+// nodeLen returns the length of the source range spanned by n
+func nodeLen(n ast.Node) int {
+	return int(n.End() - n.Pos())
+}
+
+// writingCalls returns the calls within n that pass one of the given writers
+// to a function that may write the response, or that call a function literal
+// stored in a local variable that does. Function literals called immediately
+// are descended into, as they may write to a captured writer, see
+// inspectCalled.
+func writingCalls(f *facts, n ast.Node, ws derivedSet) []*ast.CallExpr {
+	var calls []*ast.CallExpr
+	inspectCalled(n, func(node ast.Node) bool {
+		ce, ok := node.(*ast.CallExpr)
 		if !ok {
-			continue
-		}
-		if info.Uses[ident] == v {
 			return true
 		}
-	}
+		if passesArgument(f, ce, ws) {
+			calls = append(calls, ce)
+		} else if lit := f.closure(ce); lit != nil && len(writingCalls(f, lit.Body, ws)) > 0 {
+			calls = append(calls, ce)
+		}
+		return true
+	})
+	return calls
+}
+
+// inspectCalled is like ast.Inspect, but only descends into the function
+// literals that are called immediately, e.g. func() { ... }(), whose calls
+// happen where the literal is defined. Literals that are stored, deferred or
+// started as goroutines are not descended into.
+func inspectCalled(n ast.Node, fn func(ast.Node) bool) {
+	called := make(map[*ast.FuncLit]bool)
+	deferred := make(map[*ast.FuncLit]bool)
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.DeferStmt:
+			if lit, ok := n.Call.Fun.(*ast.FuncLit); ok {
+				deferred[lit] = true
+			}
+		case *ast.GoStmt:
+			if lit, ok := n.Call.Fun.(*ast.FuncLit); ok {
+				deferred[lit] = true
+			}
+		case *ast.CallExpr:
+			if lit, ok := n.Fun.(*ast.FuncLit); ok && !deferred[lit] {
+				called[lit] = true
+			}
+		case *ast.FuncLit:
+			if !called[n] {
+				return false
+			}
+		}
+		return fn(n)
+	})
+}
 
+// passesArgument returns true if the given call expression has one of the
+// given writers as one of its arguments, and the called function may write the
+// response
+func passesArgument(f *facts, ce *ast.CallExpr, ws derivedSet) bool {
+	for _, arg := range ce.Args {
+		if ws.derived(f.pass.TypesInfo, arg) {
+			return f.callWrites(ce, writeConditional)
+		}
+	}
 	return false
 }
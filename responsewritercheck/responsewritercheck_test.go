@@ -1,6 +1,8 @@
 package responsewritercheck
 
 import (
+	"go/ast"
+	"go/token"
 	"testing"
 
 	"golang.org/x/tools/go/analysis/analysistest"
@@ -15,8 +17,8 @@ func TestResponseWriterCheck(t *testing.T) {
 	import "net/http"
 
 	type api struct {}
-	func WriteSuccess(w http.ResponseWriter) {}
-	func WriteError(w http.ResponseWriter) {}
+	func WriteSuccess(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) }
+	func WriteError(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) }
 
 	func (a *api) httpHandlerBasic(w http.ResponseWriter, req *http.Request) {
 		WriteSuccess(w) // OK
@@ -79,3 +81,806 @@ func TestResponseWriterCheck(t *testing.T) {
 	defer cleanup()
 	analysistest.Run(t, dir, Analyzer, "a")
 }
+
+// TestResponseWriterCheckMissingWrite tests that the responsewritercheck
+// analyzer reports HTTP handlers with paths that never write a response
+func TestResponseWriterCheckMissingWrite(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+	import "net/http"
+
+	type api struct {}
+	func WriteSuccess(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) }
+	func WriteError(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) }
+	func WriteJSON(w http.ResponseWriter, v interface{}) error { w.WriteHeader(http.StatusOK); return nil }
+
+	func (a *api) httpHandlerNoWrite(w http.ResponseWriter, req *http.Request) { // want httpHandlerNoWrite:"writes never"
+	} // want "http handler httpHandlerNoWrite returns without writing a response"
+
+	func (a *api) httpHandlerIfNoWrite(w http.ResponseWriter, req *http.Request) { // want httpHandlerIfNoWrite:"writes conditional"
+		if true {
+			return // want "http handler httpHandlerIfNoWrite returns without writing a response"
+		}
+		WriteSuccess(w)
+	}
+
+	func (a *api) httpHandlerIfElseNoWrite(w http.ResponseWriter, req *http.Request) { // want httpHandlerIfElseNoWrite:"writes conditional"
+		if true {
+			WriteError(w)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	} // want "http handler httpHandlerIfElseNoWrite returns without writing a response"
+
+	func (a *api) httpHandlerWriteHeader(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent) // OK
+	}
+
+	func (a *api) httpHandlerNested(w http.ResponseWriter, req *http.Request) {
+		if err := WriteJSON(w, nil); err != nil { // OK
+			return
+		}
+	}
+
+	func (a *api) httpHandlerPanic(w http.ResponseWriter, req *http.Request) {
+		if true {
+			panic("unreachable") // OK
+		}
+		WriteSuccess(w)
+	}
+
+	func (a *api) httpHandlerGroupedParams(x, y int, w http.ResponseWriter, req *http.Request) {
+		WriteSuccess(w) // OK
+	}
+
+	func notAHandler(w http.ResponseWriter) { // want notAHandler:"writes never"
+	}
+
+	func checkAuth(w http.ResponseWriter, req *http.Request) bool { // want checkAuth:"writes conditional"
+		if req.Header.Get("Authorization") == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return false
+		}
+		return true // OK
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, Analyzer, "a")
+}
+
+// TestResponseWriterCheckFacts tests that the responsewritercheck analyzer
+// computes which functions write the response, across packages, and does not
+// count passing the writer to functions that never write it
+func TestResponseWriterCheckFacts(t *testing.T) {
+	files := map[string]string{"b/b.go": `package b
+
+	import "net/http"
+
+	func SetCORSHeaders(w http.ResponseWriter) { // want SetCORSHeaders:"writes never"
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+
+	func WriteJSON(w http.ResponseWriter, v interface{}) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	func WriteIfErr(w http.ResponseWriter, err error) bool { // want WriteIfErr:"writes conditional"
+		if err != nil {
+			WriteJSON(w, err)
+			return true
+		}
+		return false
+	}
+
+	func Wrap(w http.ResponseWriter) http.ResponseWriter { // want Wrap:"writes never"
+		SetCORSHeaders(w)
+		return w
+	}
+`, "a/a.go": `package a
+
+	import (
+		"b"
+		"net/http"
+	)
+
+	func setCacheHeaders(w http.ResponseWriter) { // want setCacheHeaders:"writes never"
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	func httpHandlerHelpers(w http.ResponseWriter, req *http.Request) {
+		b.SetCORSHeaders(w)
+		setCacheHeaders(w)
+		b.Wrap(w)
+		b.WriteJSON(w, nil) // OK
+	}
+
+	func httpHandlerFail(w http.ResponseWriter, req *http.Request) {
+		b.WriteJSON(w, nil) // want "http.Responsewriter passed to more than one function"
+		b.WriteIfErr(w, nil)
+	}
+
+	func httpHandlerGuard(w http.ResponseWriter, req *http.Request) { // want httpHandlerGuard:"writes conditional"
+		if b.WriteIfErr(w, nil) { // OK
+			return
+		}
+		b.WriteJSON(w, nil)
+	}
+
+	func httpHandlerGuardInit(w http.ResponseWriter, req *http.Request) { // want httpHandlerGuardInit:"writes conditional"
+		if written := b.WriteIfErr(w, nil); written { // OK
+			return
+		}
+		b.WriteJSON(w, nil)
+	}
+
+	func httpHandlerGuardNoReturn(w http.ResponseWriter, req *http.Request) {
+		if b.WriteIfErr(w, nil) { // want "http.Responsewriter passed to more than one function"
+			setCacheHeaders(w)
+		}
+		b.WriteJSON(w, nil)
+	}
+
+	func httpHandlerOnlyHeaders(w http.ResponseWriter, req *http.Request) { // want httpHandlerOnlyHeaders:"writes never"
+		b.SetCORSHeaders(w)
+	} // want "http handler httpHandlerOnlyHeaders returns without writing a response"
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, Analyzer, "a", "b")
+}
+
+// TestResponseWriterCheckWrappers tests that the responsewritercheck analyzer
+// tracks aliases and wrappers of the http.ResponseWriter
+func TestResponseWriterCheckWrappers(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+	import "net/http"
+
+	type gzipWriter struct {
+		http.ResponseWriter
+	}
+	type loggingWriter struct {
+		ResponseWriter http.ResponseWriter
+		status         int
+	}
+	func WriteSuccess(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) }
+	func WriteError(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) }
+
+	func httpHandlerAlias(w http.ResponseWriter, req *http.Request) {
+		rw := w
+		WriteSuccess(rw) // want "http.Responsewriter passed to more than one function"
+		WriteError(w)
+	}
+
+	func httpHandlerStruct(w http.ResponseWriter, req *http.Request) {
+		gw := gzipWriter{w}
+		WriteSuccess(gw) // want "http.Responsewriter passed to more than one function"
+		WriteError(w)
+	}
+
+	func httpHandlerPointer(w http.ResponseWriter, req *http.Request) {
+		lw := &loggingWriter{ResponseWriter: w}
+		WriteSuccess(lw.ResponseWriter) // want "http.Responsewriter passed to more than one function"
+		WriteError(w)
+	}
+
+	func httpHandlerConversion(w http.ResponseWriter, req *http.Request) {
+		var rw http.ResponseWriter = gzipWriter{w}
+		WriteSuccess(http.ResponseWriter(rw)) // want "http.Responsewriter passed to more than one function"
+		WriteError(w)
+	}
+
+	func httpHandlerWrapperWrite(w http.ResponseWriter, req *http.Request) {
+		gw := gzipWriter{ResponseWriter: w}
+		gw.WriteHeader(http.StatusOK) // OK
+	}
+
+	func httpHandlerWrapperOnly(w http.ResponseWriter, req *http.Request) {
+		gw := gzipWriter{w}
+		if true {
+			WriteError(gw)
+			return
+		}
+		WriteSuccess(gw) // OK
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, Analyzer, "a")
+}
+
+// TestResponseWriterCheckHeaderAfterWrite tests that the responsewritercheck
+// analyzer reports header mutations after the response has been written
+func TestResponseWriterCheckHeaderAfterWrite(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+	import "net/http"
+
+	func WriteJSON(w http.ResponseWriter, v interface{}) { w.WriteHeader(http.StatusOK) }
+
+	func httpHandlerHeaderFirst(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json") // OK
+		w.WriteHeader(http.StatusOK)                       // OK
+		w.Write(nil)
+	}
+
+	func httpHandlerHeaderAfter(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json") // want "http.ResponseWriter header modified after the response was written"
+	}
+
+	func httpHandlerWriteHeaderAfter(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("foo"))
+		w.WriteHeader(http.StatusOK) // want "http.ResponseWriter.WriteHeader called after the response was written"
+	}
+
+	func httpHandlerHeaderAfterHelper(w http.ResponseWriter, req *http.Request) {
+		WriteJSON(w, nil)
+		if true {
+			w.Header().Add("X-Foo", "bar") // want "http.ResponseWriter header modified after the response was written"
+		}
+	}
+
+	func httpHandlerHeaderOtherBranch(w http.ResponseWriter, req *http.Request) {
+		if true {
+			WriteJSON(w, nil)
+			return
+		}
+		w.Header().Del("X-Foo") // OK
+		WriteJSON(w, nil)
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, Analyzer, "a")
+}
+
+// TestResponseWriterCheckRelated tests that the responsewritercheck analyzer
+// reports each pair of conflicting writes once, pointing at the second write
+// and the path between them
+func TestResponseWriterCheckRelated(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+	import "net/http"
+
+	func WriteSuccess(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) }
+	func WriteError(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) }
+
+	func httpHandlerBasicFail(w http.ResponseWriter, req *http.Request) {
+		WriteSuccess(w) // want "http.Responsewriter passed to more than one function"
+		WriteError(w)   // want "http.Responsewriter passed to more than one function"
+		WriteError(w)
+	}
+
+	func httpHandlerBranches(w http.ResponseWriter, req *http.Request) {
+		WriteSuccess(w) // want "http.Responsewriter passed to more than one function" "http.Responsewriter passed to more than one function"
+		if true {
+			WriteError(w)
+		} else {
+			WriteError(w)
+		}
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	results := analysistest.Run(t, dir, Analyzer, "a")
+
+	// The expectations above ensure the number of diagnostics is right, check
+	// that each one points at the conflicting write.
+	for _, r := range results {
+		for _, d := range r.Diagnostics {
+			if len(d.Related) == 0 {
+				t.Fatalf("diagnostic %q has no related information", d.Message)
+			}
+			last := d.Related[len(d.Related)-1]
+			if last.Message != "http.Responsewriter passed again here" {
+				t.Errorf("unexpected related information %q", last.Message)
+			}
+			if last.Pos <= d.Pos {
+				t.Errorf("conflicting write at %v is not after the first write at %v", last.Pos, d.Pos)
+			}
+		}
+	}
+}
+
+// TestResponseWriterCheckNested tests that the responsewritercheck analyzer
+// handles usages of the http.ResponseWriter nested within other statements
+func TestResponseWriterCheckNested(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+	import "net/http"
+
+	func WriteSuccess(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) }
+	func WriteError(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) }
+	func WriteJSON(w http.ResponseWriter, v interface{}) error { w.WriteHeader(http.StatusOK); return nil }
+
+	func httpHandlerIfInit(w http.ResponseWriter, req *http.Request) {
+		if err := WriteJSON(w, nil); err != nil { // want "http.Responsewriter passed to more than one function"
+			WriteError(w)
+		}
+	}
+
+	func httpHandlerSwitch(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			WriteSuccess(w) // want "http.Responsewriter passed to more than one function"
+		default:
+			WriteError(w) // OK
+			return
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerTypeSwitch(w http.ResponseWriter, req *http.Request) {
+		var v interface{}
+		switch v.(type) {
+		case int:
+			if err := WriteJSON(w, v); err != nil { // OK
+				return
+			}
+		default:
+			WriteError(w) // OK
+		}
+	}
+
+	func httpHandlerFuncLit(w http.ResponseWriter, req *http.Request) {
+		func() {
+			WriteSuccess(w) // want "http.Responsewriter passed to more than one function"
+		}()
+		WriteError(w)
+	}
+
+	func httpHandlerStoredFuncLit(w http.ResponseWriter, req *http.Request) {
+		fail := func() {
+			WriteError(w) // OK
+		}
+		if req.Method != "GET" {
+			fail()
+			return // OK
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerStoredFuncLitTwice(w http.ResponseWriter, req *http.Request) {
+		fail := func() {
+			WriteError(w)
+		}
+		fail() // want "http.Responsewriter passed to more than one function"
+		WriteSuccess(w)
+	}
+
+	func httpHandlerGoFuncLit(w http.ResponseWriter, req *http.Request) {
+		go func() {
+			WriteError(w)
+		}()
+		WriteSuccess(w) // OK
+	}
+
+	func httpHandlerSelect(w http.ResponseWriter, req *http.Request) {
+		errs := make(chan error)
+		select {
+		// the values sent are evaluated when entering the select statement
+		case errs <- WriteJSON(w, nil): // want "http.Responsewriter passed to more than one function"
+		case <-req.Context().Done():
+			WriteError(w) // OK
+		}
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, Analyzer, "a")
+}
+
+// TestResponseWriterCheckLoop tests that the responsewritercheck analyzer
+// reports writes inside loops that may execute more than once
+func TestResponseWriterCheckLoop(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+	import "net/http"
+
+	func WriteSuccess(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) }
+	func WriteError(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) }
+
+	func httpHandlerFor(w http.ResponseWriter, req *http.Request) {
+		for {
+			WriteSuccess(w) // want "http.Responsewriter written inside loop"
+		}
+	}
+
+	func httpHandlerRange(w http.ResponseWriter, req *http.Request) { // want httpHandlerRange:"writes conditional"
+		for range []int{1, 2} {
+			if true {
+				WriteError(w) // want "http.Responsewriter written inside loop"
+			}
+		}
+	} // want "http handler httpHandlerRange returns without writing a response"
+
+	func httpHandlerRangeReturn(w http.ResponseWriter, req *http.Request) {
+		for range []int{1, 2} {
+			if true {
+				WriteError(w) // OK
+				return
+			}
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerForBreak(w http.ResponseWriter, req *http.Request) {
+		for {
+			WriteSuccess(w) // OK
+			break
+		}
+	}
+
+	func httpHandlerGoto(w http.ResponseWriter, req *http.Request) {
+	again:
+		WriteSuccess(w) // want "http.Responsewriter written inside loop"
+		goto again
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	results := analysistest.Run(t, dir, Analyzer, "a")
+
+	// Loops should be pointed at by the related information
+	for _, r := range results {
+		for _, d := range r.Diagnostics {
+			if d.Message != "http.Responsewriter written inside loop" {
+				continue
+			}
+			pos := r.Pass.Fset.Position(d.Pos)
+			if enclosingFunc(r.Pass.Files, d.Pos) == "httpHandlerGoto" {
+				if len(d.Related) != 0 {
+					t.Error("expected no related information for goto loop")
+				}
+				continue
+			}
+			if len(d.Related) != 1 || d.Related[0].Pos >= d.Pos {
+				t.Errorf("%v: expected related information pointing at the loop", pos)
+			}
+		}
+	}
+}
+
+// enclosingFunc returns the name of the function declared in one of the files
+// that encloses pos
+func enclosingFunc(files []*ast.File, pos token.Pos) string {
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Pos() <= pos && pos < fd.End() {
+				return fd.Name.Name
+			}
+		}
+	}
+	return ""
+}
+
+// TestResponseWriterCheckStreaming tests that the responsewritercheck analyzer
+// allows streaming handlers to write many chunks, while still reporting
+// writes of the whole response after streaming has begun
+func TestResponseWriterCheckStreaming(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+	import (
+		"fmt"
+		"io"
+		"net/http"
+		"strings"
+	)
+
+	func WriteError(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) }
+
+	func httpHandlerFlusher(w http.ResponseWriter, req *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			WriteError(w) // OK
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "line %d\n", i) // OK
+			f.Flush()
+		}
+	}
+
+	//responsewritercheck:streaming
+	func httpHandlerDownload(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.Copy(w, strings.NewReader("foo")) // OK
+		w.Write([]byte("bar"))               // OK
+	}
+
+	//responsewritercheck:streaming
+	func httpHandlerErrorAfterChunk(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("foo"))
+		if true {
+			WriteError(w) // want "http.Responsewriter passed to WriteError after streaming has begun"
+			return
+		}
+		w.WriteHeader(http.StatusOK) // want "http.ResponseWriter.WriteHeader called after the response was written"
+	}
+
+	func httpHandlerNotStreaming(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "foo") // want "http.Responsewriter passed to more than one function"
+		fmt.Fprintf(w, "bar")
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, Analyzer, "a")
+}
+
+// TestResponseWriterCheckStatus tests that the responsewritercheck analyzer
+// validates status codes and Content-Type headers
+func TestResponseWriterCheckStatus(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+	import "net/http"
+
+	func WriteJSON(w http.ResponseWriter, v interface{}) { w.WriteHeader(http.StatusOK) }
+
+	func httpHandlerStatusConstant(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated) // OK
+		w.Write(nil)
+	}
+
+	func httpHandlerMagicNumber(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(201) // want "http.ResponseWriter.WriteHeader called with magic number 201, use an http.Status\\* constant instead"
+	}
+
+	func writeStatus(w http.ResponseWriter, status int) {
+		w.WriteHeader(status) // OK
+	}
+
+	func httpHandlerNoContent(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+		if true {
+			w.Write([]byte("foo")) // want "response body written after status 204, which does not allow a body"
+		}
+	}
+
+	func httpHandlerNotModified(w http.ResponseWriter, req *http.Request) {
+		if true {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		WriteJSON(w, nil) // OK
+	}
+
+	func httpHandlerContentType(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain") // want "Content-Type set to \"text/plain\" on a path writing a JSON response"
+		WriteJSON(w, nil)
+	}
+
+	func httpHandlerContentTypeJSON(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8") // OK
+		WriteJSON(w, nil)
+	}
+
+	func httpHandlerContentTypeOtherPath(w http.ResponseWriter, req *http.Request) {
+		if true {
+			w.Header().Set("Content-Type", "text/plain") // OK
+			w.Write([]byte("foo"))
+			return
+		}
+		WriteJSON(w, nil)
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, Analyzer, "a")
+}
+
+// TestResponseWriterCheckRequest tests that the responsewritercheck analyzer
+// checks the handling of the request body
+func TestResponseWriterCheckRequest(t *testing.T) {
+	files := map[string]string{"a/a.go": `package a
+
+	import (
+		"encoding/json"
+		"io/ioutil"
+		"net/http"
+	)
+
+	func WriteSuccess(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) }
+	func WriteError(w http.ResponseWriter, err error) { w.WriteHeader(http.StatusBadRequest) }
+
+	func httpHandlerDecode(w http.ResponseWriter, req *http.Request) {
+		var v struct{}
+		req.Body = http.MaxBytesReader(w, req.Body, 1<<20)
+		if err := json.NewDecoder(req.Body).Decode(&v); err != nil { // OK
+			WriteError(w, err)
+			return
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerDecodeTwice(w http.ResponseWriter, req *http.Request) {
+		var v, u struct{}
+		json.NewDecoder(req.Body).Decode(&v) // want "request body read more than once" "error from decoding the request body is not checked"
+		_, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		_ = json.Unmarshal(nil, &u)
+		WriteSuccess(w)
+	}
+
+	func httpHandlerDecodeUnchecked(w http.ResponseWriter, req *http.Request) {
+		var v struct{}
+		_ = json.NewDecoder(req.Body).Decode(&v) // want "error from decoding the request body is not checked"
+		WriteSuccess(w)
+	}
+
+	func httpHandlerDecodeLateCheck(w http.ResponseWriter, req *http.Request) {
+		var v struct{}
+		err := json.NewDecoder(req.Body).Decode(&v)
+		WriteSuccess(w) // want "response written before checking the error from decoding the request body"
+		if err != nil {
+			return
+		}
+	}
+
+	func httpHandlerForm(w http.ResponseWriter, req *http.Request) {
+		var v struct{}
+		if req.FormValue("foo") != "" { // want "request form parsed on the same path the request body is read"
+			if err := json.NewDecoder(req.Body).Decode(&v); err != nil {
+				WriteError(w, err)
+				return
+			}
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerFormOrBody(w http.ResponseWriter, req *http.Request) {
+		var v struct{}
+		if req.Method == "GET" {
+			req.ParseForm() // OK
+			WriteSuccess(w)
+			return
+		}
+		if err := json.NewDecoder(req.Body).Decode(&v); err != nil { // OK
+			WriteError(w, err)
+			return
+		}
+		WriteSuccess(w)
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, Analyzer, "a")
+}
+
+// TestResponseWriterCheckNoReturn tests that the responsewritercheck analyzer
+// ends paths at calls that never return, and checks that handlers write an
+// error when the request context is cancelled
+func TestResponseWriterCheckNoReturn(t *testing.T) {
+	files := map[string]string{"gitlab.com/NebulousLabs/Sia/build/build.go": `package build
+
+	// Critical panics in debug builds, and logs in release builds.
+	func Critical(v ...interface{}) {}
+`, "a/a.go": `package a
+
+	import (
+		"context"
+		"log"
+		"net/http"
+		"os"
+		"time"
+
+		"gitlab.com/NebulousLabs/Sia/build"
+	)
+
+	func WriteSuccess(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) }
+	func WriteError(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) }
+
+	func httpHandlerCritical(w http.ResponseWriter, req *http.Request) {
+		if true {
+			WriteError(w) // OK
+			build.Critical("unreachable")
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerCriticalWrite(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			build.Critical(err)
+			WriteError(w) // OK
+			return
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerCriticalHeader(w http.ResponseWriter, req *http.Request) {
+		if true {
+			build.Critical("unexpected")
+			WriteError(w)
+			w.Header().Set("Content-Type", "text/plain") // want "http.ResponseWriter header modified after the response was written"
+			return
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerFatal(w http.ResponseWriter, req *http.Request) {
+		if true {
+			log.Fatal("unreachable") // OK
+		}
+		if true {
+			os.Exit(1) // OK
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerCancel(w http.ResponseWriter, req *http.Request) { // want httpHandlerCancel:"writes conditional"
+		select {
+		case <-req.Context().Done(): // want "http handler httpHandlerCancel returns without writing an error when the request context is cancelled"
+			return
+		case <-time.After(time.Second):
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerCancelTimeout(w http.ResponseWriter, req *http.Request) { // want httpHandlerCancelTimeout:"writes conditional"
+		ctx, cancel := context.WithTimeout(req.Context(), time.Second)
+		defer cancel()
+		select {
+		case <-ctx.Done(): // want "http handler httpHandlerCancelTimeout returns without writing an error when the request context is cancelled"
+			if true {
+				log.Print("cancelled")
+			}
+			return
+		case <-time.After(time.Second):
+		}
+		WriteSuccess(w)
+	}
+
+	func httpHandlerCancelWrite(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		select {
+		case <-ctx.Done(): // OK
+			WriteError(w)
+			return
+		case <-time.After(time.Second):
+		}
+		WriteSuccess(w)
+	}
+`}
+	dir, cleanup, err := analysistest.WriteFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	analysistest.Run(t, dir, Analyzer, "a")
+}
@@ -0,0 +1,187 @@
+package responsewritercheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/cfg"
+)
+
+// checkStatus checks the status codes and Content-Type headers written by fd.
+// It reports:
+//   - WriteHeader calls using a magic number instead of an http.Status*
+//     constant
+//   - bodies written after a 1xx, 204 or 304 status, which must not have one
+//   - JSON helpers called on a path that sets a non-JSON Content-Type
+func checkStatus(f *facts, fd *ast.FuncDecl, ws derivedSet) {
+	pass := f.pass
+	info := pass.TypesInfo
+	g := f.cfg(fd)
+
+	for _, b := range g.Blocks {
+		if !b.Live {
+			continue
+		}
+		for i, n := range b.Nodes {
+			for _, ce := range methodCalls(info, n, ws, "WriteHeader") {
+				if len(ce.Args) != 1 {
+					continue
+				}
+				code, isConst := constantStatus(info, ce.Args[0])
+				if isConst && !isStatusConstant(info, ce.Args[0]) {
+					pass.Reportf(ce.Args[0].Pos(), "http.ResponseWriter.WriteHeader called with magic number %d, use an http.Status* constant instead", code)
+				}
+				if isConst && !bodyAllowed(code) {
+					checkNoBody(f, b, i, ws, ce, code)
+				}
+			}
+			for _, ce := range headerSets(info, n, ws, "Content-Type") {
+				contentType, ok := constantString(info, ce.Args[1])
+				if ok && !strings.Contains(contentType, "json") {
+					checkNoJSON(f, b, i, ws, ce, contentType)
+				}
+			}
+		}
+	}
+}
+
+// checkNoBody reports writes of a body after the WriteHeader call wh, the i-th
+// node of b, wrote the given status code which does not allow one.
+func checkNoBody(f *facts, b *cfg.Block, i int, ws derivedSet, wh *ast.CallExpr, code int64) {
+	pass := f.pass
+	info := pass.TypesInfo
+
+	reported := make(map[*ast.CallExpr]bool)
+	report := func(n ast.Node) bool {
+		calls := methodCalls(info, n, ws, "Write")
+		calls = append(calls, writingCalls(f, n, ws)...)
+		for _, ce := range calls {
+			if reported[ce] {
+				continue
+			}
+			reported[ce] = true
+			pass.Report(analysis.Diagnostic{
+				Pos:     ce.Pos(),
+				Message: fmt.Sprintf("response body written after status %d, which does not allow a body", code),
+				Related: []analysis.RelatedInformation{{
+					Pos:     wh.Pos(),
+					End:     wh.End(),
+					Message: "status written here",
+				}},
+			})
+		}
+		// keep searching, every reachable write is reported
+		return false
+	}
+	containsNode(b.Nodes[i+1:], report)
+	search(make(map[*cfg.Block]bool), b.Succs, report)
+}
+
+// checkNoJSON reports the header mutation set, the i-th node of b, which sets
+// the non-JSON contentType, if a JSON helper is called on a path after it.
+func checkNoJSON(f *facts, b *cfg.Block, i int, ws derivedSet, set *ast.CallExpr, contentType string) {
+	pass := f.pass
+
+	isJSON := func(n ast.Node) bool {
+		for _, ce := range writingCalls(f, n, ws) {
+			if strings.Contains(calleeName(ce), "JSON") {
+				return true
+			}
+		}
+		return false
+	}
+	helper := firstNode(b.Nodes[i+1:], isJSON)
+	if helper == nil {
+		helper = search(make(map[*cfg.Block]bool), b.Succs, isJSON)
+	}
+	if helper == nil {
+		return
+	}
+	pass.Report(analysis.Diagnostic{
+		Pos:     set.Pos(),
+		Message: fmt.Sprintf("Content-Type set to %q on a path writing a JSON response", contentType),
+		Related: []analysis.RelatedInformation{{
+			Pos:     helper.Pos(),
+			End:     helper.End(),
+			Message: "JSON response written here",
+		}},
+	})
+}
+
+// bodyAllowed returns whether a response with the given status code may have a
+// body.
+func bodyAllowed(code int64) bool {
+	return !(code >= 100 && code < 200 || code == 204 || code == 304)
+}
+
+// constantStatus returns the value of the status code e if it is an integer
+// constant
+func constantStatus(info *types.Info, e ast.Expr) (int64, bool) {
+	tv, ok := info.Types[e]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.Int {
+		return 0, false
+	}
+	return constant.Int64Val(tv.Value)
+}
+
+// constantString returns the value of e if it is a string constant
+func constantString(info *types.Info, e ast.Expr) (string, bool) {
+	tv, ok := info.Types[e]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+// isStatusConstant returns true if e refers to one of the http.Status*
+// constants
+func isStatusConstant(info *types.Info, e ast.Expr) bool {
+	var ident *ast.Ident
+	switch e := e.(type) {
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		ident = e.Sel
+	default:
+		return false
+	}
+	c, ok := info.Uses[ident].(*types.Const)
+	return ok && c.Pkg() != nil && c.Pkg().Path() == "net/http" && strings.HasPrefix(c.Name(), "Status")
+}
+
+// methodCalls returns the calls within n of the given method on one of the
+// given writers. Function literals are not descended into.
+func methodCalls(info *types.Info, n ast.Node, ws derivedSet, method string) []*ast.CallExpr {
+	var calls []*ast.CallExpr
+	ast.Inspect(n, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		if ce, ok := n.(*ast.CallExpr); ok && isMethodCall(info, ce, ws, method) {
+			calls = append(calls, ce)
+		}
+		return true
+	})
+	return calls
+}
+
+// headerSets returns the calls within n that set the given header of one of
+// the given writers, i.e. w.Header().Set(key, value) or Add. Function literals
+// are not descended into.
+func headerSets(info *types.Info, n ast.Node, ws derivedSet, key string) []*ast.CallExpr {
+	var calls []*ast.CallExpr
+	for _, ce := range headerMutations(info, n, ws) {
+		se := ce.Fun.(*ast.SelectorExpr)
+		if se.Sel.Name != "Set" && se.Sel.Name != "Add" || len(ce.Args) != 2 {
+			continue
+		}
+		if k, ok := constantString(info, ce.Args[0]); ok && strings.EqualFold(k, key) {
+			calls = append(calls, ce)
+		}
+	}
+	return calls
+}
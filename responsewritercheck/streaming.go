@@ -0,0 +1,143 @@
+package responsewritercheck
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/cfg"
+)
+
+// streamingDirective marks a handler as streaming its response in the doc
+// comment of the handler.
+const streamingDirective = "//responsewritercheck:streaming"
+
+// isStreaming returns true if fd streams its response in multiple chunks,
+// e.g. a log tail or a file download. A function is streaming if it is
+// annotated with the streaming directive, or if it flushes the writer through
+// http.Flusher.
+func isStreaming(info *types.Info, fd *ast.FuncDecl, ws derivedSet) bool {
+	if fd.Doc != nil {
+		for _, c := range fd.Doc.List {
+			if strings.TrimSpace(c.Text) == streamingDirective {
+				return true
+			}
+		}
+	}
+
+	var flushes bool
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		if ce, ok := n.(*ast.CallExpr); ok && isMethodCall(info, ce, ws, "Flush") {
+			flushes = true
+		}
+		return !flushes
+	})
+	return flushes
+}
+
+// isChunkWrite returns true if ce writes a chunk of the response body rather
+// than the whole response. That is the case for the Write and Flush methods of
+// the writer, and for functions receiving the writer as an io.Writer instead of
+// as an http.ResponseWriter, e.g. fmt.Fprintf or io.Copy.
+func isChunkWrite(info *types.Info, ce *ast.CallExpr, ws derivedSet) bool {
+	if isMethodCall(info, ce, ws, "Write") || isMethodCall(info, ce, ws, "Flush") {
+		return true
+	}
+	sig, ok := info.TypeOf(ce.Fun).(*types.Signature)
+	if !ok {
+		return false
+	}
+	for i, arg := range ce.Args {
+		if !ws.derived(info, arg) {
+			continue
+		}
+		if t := paramType(sig, i); t != nil && t.String() != "net/http.ResponseWriter" {
+			return true
+		}
+	}
+	return false
+}
+
+// paramType returns the type of the param of sig receiving the i-th argument,
+// or nil if there is no such param
+func paramType(sig *types.Signature, i int) types.Type {
+	params := sig.Params()
+	if sig.Variadic() && i >= params.Len()-1 {
+		return params.At(params.Len() - 1).Type().(*types.Slice).Elem()
+	}
+	if i >= params.Len() {
+		return nil
+	}
+	return params.At(i).Type()
+}
+
+// isMethodCall returns true if ce calls the given method on one of the given
+// writers
+func isMethodCall(info *types.Info, ce *ast.CallExpr, ws derivedSet, method string) bool {
+	se, ok := ce.Fun.(*ast.SelectorExpr)
+	return ok && se.Sel.Name == method && ws.derived(info, se.X)
+}
+
+// checkStreaming reports response helpers, such as WriteError, that are
+// passed the writer of the streaming function fd after streaming has begun. At
+// that point the status code has been sent, and the body is already partially
+// written.
+func checkStreaming(f *facts, fd *ast.FuncDecl, ws derivedSet) {
+	pass := f.pass
+	info := pass.TypesInfo
+	g := f.cfg(fd)
+
+	chunk := func(n ast.Node) bool {
+		var found bool
+		ast.Inspect(n, func(n ast.Node) bool {
+			if _, ok := n.(*ast.FuncLit); ok {
+				return false
+			}
+			if ce, ok := n.(*ast.CallExpr); ok && isChunkWrite(info, ce, ws) {
+				if isMethodCall(info, ce, ws, "Write") || isMethodCall(info, ce, ws, "Flush") || passesArgument(f, ce, ws) {
+					found = true
+				}
+			}
+			return !found
+		})
+		return found
+	}
+
+	reported := make(map[*ast.CallExpr]bool)
+	report := func(n ast.Node) bool {
+		for _, ce := range writingCalls(f, n, ws) {
+			if reported[ce] || isChunkWrite(info, ce, ws) {
+				continue
+			}
+			reported[ce] = true
+			pass.Reportf(ce.Pos(), "http.Responsewriter passed to %s after streaming has begun", calleeName(ce))
+		}
+		// keep searching, every reachable helper is reported
+		return false
+	}
+
+	for _, b := range g.Blocks {
+		if !b.Live {
+			continue
+		}
+		for i, n := range b.Nodes {
+			if !chunk(n) {
+				continue
+			}
+			containsNode(b.Nodes[i+1:], report)
+			search(make(map[*cfg.Block]bool), b.Succs, report)
+		}
+	}
+}
+
+// calleeName returns the name of the function called by ce, as written in the
+// source
+func calleeName(ce *ast.CallExpr) string {
+	switch fun := ce.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name
+	case *ast.SelectorExpr:
+		return fun.Sel.Name
+	}
+	return "function"
+}
@@ -0,0 +1,142 @@
+package responsewritercheck
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// derivedSet is the set of variables that hold an original value, such as the
+// http.ResponseWriter or the *http.Request of a handler, or a value derived
+// from it. Uses of any of them are uses of the same original value.
+type derivedSet map[types.Object]bool
+
+// trackDerived returns the derivedSet of v within body. Besides v itself it
+// contains every variable that is assigned an alias (rw := w), a wrapping
+// struct (gw := gzipWriter{w}, lw := &loggingWriter{ResponseWriter: w}) or an
+// interface conversion (f := w.(http.Flusher)) of a tracked variable.
+func trackDerived(info *types.Info, body ast.Node, v *types.Var) derivedSet {
+	ws := derivedSet{v: true}
+
+	// assignments are revisited until no new variable is found, as a variable
+	// can be derived from another one that is only discovered later on (e.g.
+	// in a loop)
+	for changed := true; changed; {
+		changed = false
+		track := func(lhs ast.Expr, rhs ast.Expr) {
+			ident, ok := lhs.(*ast.Ident)
+			if !ok || ident.Name == "_" {
+				return
+			}
+			obj := info.ObjectOf(ident)
+			if obj == nil || ws[obj] || !ws.derived(info, rhs) {
+				return
+			}
+			ws[obj] = true
+			changed = true
+		}
+		ast.Inspect(body, func(n ast.Node) bool {
+			switch s := n.(type) {
+			case *ast.AssignStmt:
+				if len(s.Lhs) == len(s.Rhs) {
+					for i := range s.Lhs {
+						track(s.Lhs[i], s.Rhs[i])
+					}
+				} else if len(s.Rhs) == 1 {
+					// e.g. f, ok := w.(http.Flusher)
+					track(s.Lhs[0], s.Rhs[0])
+				}
+			case *ast.ValueSpec:
+				if len(s.Names) == len(s.Values) {
+					for i := range s.Names {
+						track(s.Names[i], s.Values[i])
+					}
+				} else if len(s.Values) == 1 {
+					track(s.Names[0], s.Values[0])
+				}
+			}
+			return true
+		})
+	}
+	return ws
+}
+
+// derived returns true if e evaluates to one of the tracked variables or to a
+// value derived from one, such as a struct wrapping it.
+func (ws derivedSet) derived(info *types.Info, e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return ws[info.ObjectOf(e)]
+	case *ast.ParenExpr:
+		return ws.derived(info, e.X)
+	case *ast.StarExpr:
+		return ws.derived(info, e.X)
+	case *ast.UnaryExpr:
+		return e.Op == token.AND && ws.derived(info, e.X)
+	case *ast.SelectorExpr:
+		// a field of a wrapping struct, e.g. lw.ResponseWriter
+		return ws.derived(info, e.X)
+	case *ast.TypeAssertExpr:
+		return ws.derived(info, e.X)
+	case *ast.CompositeLit:
+		for _, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = kv.Value
+			}
+			if ws.derived(info, elt) {
+				return true
+			}
+		}
+	case *ast.CallExpr:
+		// a type conversion, e.g. http.ResponseWriter(w)
+		if tv, ok := info.Types[e.Fun]; ok && tv.IsType() && len(e.Args) == 1 {
+			return ws.derived(info, e.Args[0])
+		}
+	}
+	return false
+}
+
+// storeClosures adds the function literals stored in the local variables
+// declared within body to closures, e.g. fail := func() { WriteError(w) }.
+// Variables that are reassigned are omitted, as the literal they hold when
+// called is unknown.
+func storeClosures(info *types.Info, body ast.Node, closures map[*types.Var]*ast.FuncLit) {
+	reassigned := make(map[*types.Var]bool)
+	store := func(ident *ast.Ident, rhs ast.Expr) {
+		if v, ok := info.Defs[ident].(*types.Var); ok {
+			if lit, ok := rhs.(*ast.FuncLit); ok {
+				closures[v] = lit
+			}
+		} else if v, ok := info.Uses[ident].(*types.Var); ok {
+			reassigned[v] = true
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range s.Lhs {
+				ident, ok := lhs.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				var rhs ast.Expr
+				if len(s.Lhs) == len(s.Rhs) {
+					rhs = s.Rhs[i]
+				}
+				store(ident, rhs)
+			}
+		case *ast.ValueSpec:
+			for i, name := range s.Names {
+				var rhs ast.Expr
+				if len(s.Names) == len(s.Values) {
+					rhs = s.Values[i]
+				}
+				store(name, rhs)
+			}
+		}
+		return true
+	})
+	for v := range reassigned {
+		delete(closures, v)
+	}
+}